@@ -0,0 +1,211 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func HandleAlwaysOnCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var enabled, playlistGiven bool
+	var voiceChannelID, playlistName string
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "enabled":
+			enabled = option.BoolValue()
+		case "channel":
+			voiceChannelID = option.ChannelValue(nil).ID
+		case "playlist":
+			playlistGiven = true
+			playlistName = strings.TrimSpace(option.StringValue())
+		}
+	}
+
+	if !enabled {
+		if _, err := GlobalSettings.Update(i.GuildID, func(gs *GuildSettings) { gs.AlwaysOn = false }); err != nil {
+			logErrorf("Failed to turn off 24/7 mode in guild %s: %v", i.GuildID, err)
+			respondEphemeral(s, i, "❌ Couldn't save that change, please try again.")
+			return
+		}
+		UpdateIdleState(s, i.GuildID)
+		respondAlwaysOnEmbed(s, i, "📻 24/7 Mode Off", "I'll leave the voice channel again once it's idle or empty, following `/settings idle_timeout` and `alone_timeout`.")
+		return
+	}
+
+	if voiceChannelID == "" {
+		voiceChannelID = findUserVoiceChannel(s, i.GuildID, GetUserID(i))
+	}
+	if voiceChannelID == "" {
+		respondEphemeral(s, i, "❌ Pick a voice channel, or join the one I should stay in.")
+		return
+	}
+
+	if strings.EqualFold(playlistName, "none") {
+		playlistName = ""
+	} else if playlistName != "" {
+		playlist, found, err := findPlaylist(i.GuildID, "", playlistName, PlaylistServer)
+		if err != nil {
+			logErrorf("Failed to load playlist %q: %v", playlistName, err)
+			respondEphemeral(s, i, "❌ Couldn't load that playlist, please try again.")
+			return
+		}
+		if !found {
+			respondEphemeral(s, i, fmt.Sprintf("❌ There's no server playlist called **%s**. Create one with `/playlist create scope:server`.", playlistName))
+			return
+		}
+		playlistName = playlist.Name
+	}
+
+	settings, err := GlobalSettings.Update(i.GuildID, func(gs *GuildSettings) {
+		gs.AlwaysOn = true
+		gs.AlwaysOnChannelID = voiceChannelID
+		gs.AlwaysOnTextChannelID = i.ChannelID
+		if playlistGiven {
+			gs.FallbackPlaylist = playlistName
+		}
+	})
+	if err != nil {
+		logErrorf("Failed to turn on 24/7 mode in guild %s: %v", i.GuildID, err)
+		respondEphemeral(s, i, "❌ Couldn't save that change, please try again.")
+		return
+	}
+
+	// Joining the voice channel can take longer than Discord waits for a response
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		logWarnf("Failed to defer interaction: %v", err)
+		return
+	}
+
+	// Moving reuses the connection like /join does, so anything playing carries on in the 24/7 channel
+	if currentVoiceChannel(i.GuildID) != voiceChannelID {
+		if err := JoinVoiceChannel(s, i.GuildID, voiceChannelID); err != nil {
+			logWarnf("Failed to join 24/7 channel in guild %s: %v", i.GuildID, err)
+			sendErrorFollowup(s, i, "24/7 mode is on, but I couldn't join that voice channel. Check that I'm allowed to connect.")
+			return
+		}
+	}
+	UpdateIdleState(s, i.GuildID)
+	continueAlwaysOn(s, i.GuildID)
+
+	description := fmt.Sprintf("I'll stay in <#%s> and come back after restarts or disconnections.", voiceChannelID)
+	if settings.FallbackPlaylist != "" {
+		description += fmt.Sprintf("\nWhen the queue runs out I'll play the **%s** server playlist.", settings.FallbackPlaylist)
+	} else {
+		description += "\nAdd `playlist:` to keep music going when the queue runs out."
+	}
+	sendEmbedFollowup(s, i, &discordgo.MessageEmbed{
+		Title:       "📻 24/7 Mode On",
+		Description: description,
+		Color:       0x1DB954,
+	})
+}
+
+func respondAlwaysOnEmbed(s *discordgo.Session, i *discordgo.InteractionCreate, title, description string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{Title: title, Description: description, Color: 0x1DB954},
+			},
+		},
+	})
+	if err != nil {
+		logWarnf("Failed to respond to 247 command: %v", err)
+	}
+}
+
+// Keeps a 24/7 channel from going silent by queueing the fallback playlist, shuffled, once nothing is
+// playing, queued or downloading
+func continueAlwaysOn(discord *discordgo.Session, guildID string) {
+	settings := GlobalSettings.Get(guildID)
+	if !settings.AlwaysOn || settings.FallbackPlaylist == "" || !GlobalQueue.IsInVoiceChannel(guildID) {
+		return
+	}
+
+	playlist, found, err := findPlaylist(guildID, "", settings.FallbackPlaylist, PlaylistServer)
+	if err != nil {
+		logWarnf("Failed to load fallback playlist %q in guild %s: %v", settings.FallbackPlaylist, guildID, err)
+		return
+	}
+	if !found || len(playlist.Tracks) == 0 {
+		ErrorChan <- GuildError{GuildID: guildID, Err: fmt.Errorf("the 24/7 fallback playlist **%s** is missing or empty", settings.FallbackPlaylist)}
+		return
+	}
+	tracks := append([]VideoInfo(nil), playlist.Tracks...)
+	rand.Shuffle(len(tracks), func(a, b int) { tracks[a], tracks[b] = tracks[b], tracks[a] })
+
+	// Checked and marked pending in one go so two callers can't both queue the playlist
+	GlobalQueue.Lock()
+	textChannelID := GlobalQueue.textChannels[guildID]
+	if textChannelID == "" {
+		textChannelID = settings.AlwaysOnTextChannelID
+	}
+	if GlobalQueue.playing[guildID] || len(GlobalQueue.queues[textChannelID]) > 0 || len(GlobalQueue.pending[textChannelID]) > 0 {
+		GlobalQueue.Unlock()
+		return
+	}
+	GlobalQueue.textChannels[guildID] = textChannelID
+	GlobalQueue.pending[textChannelID] = append(GlobalQueue.pending[textChannelID], tracks...)
+	GlobalQueue.Unlock()
+
+	logInfof("Queue ran out in 24/7 guild %s, playing fallback playlist %s", guildID, playlist.Name)
+	go func() {
+		if failed := GlobalQueue.downloadPending(discord, guildID, textChannelID, tracks); failed > 0 {
+			ErrorChan <- GuildError{GuildID: guildID, Err: fmt.Errorf("%d tracks from the fallback playlist **%s** couldn't be downloaded", failed, playlist.Name)}
+		}
+	}()
+}
+
+// Called once the bot is ready, after any saved sessions have been resumed
+func RestoreAlwaysOn(discord *discordgo.Session) {
+	for _, guildID := range GlobalSettings.GuildIDs(func(gs GuildSettings) bool { return gs.AlwaysOn }) {
+		if GlobalQueue.IsInVoiceChannel(guildID) {
+			continue
+		}
+		rejoinAlwaysOn(discord, guildID)
+	}
+}
+
+func rejoinAlwaysOn(discord *discordgo.Session, guildID string) {
+	settings := GlobalSettings.Get(guildID)
+	if !settings.AlwaysOn || settings.AlwaysOnChannelID == "" {
+		return
+	}
+	if err := JoinVoiceChannel(discord, guildID, settings.AlwaysOnChannelID); err != nil {
+		ErrorChan <- GuildError{GuildID: guildID, Err: fmt.Errorf("couldn't rejoin the 24/7 voice channel: %v", err)}
+		return
+	}
+	logInfof("Rejoined 24/7 channel %s in guild %s", settings.AlwaysOnChannelID, guildID)
+	continueAlwaysOn(discord, guildID)
+}
+
+// Only server playlists are offered, a personal one could be changed or deleted by its owner at any time
+func HandleAlwaysOnAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var typed string
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "playlist" && option.Focused {
+			typed = strings.ToLower(strings.TrimSpace(option.StringValue()))
+		}
+	}
+
+	playlists, err := listPlaylists(PlaylistServer, i.GuildID, "")
+	if err != nil {
+		logErrorf("Failed to list server playlists for guild %s: %v", i.GuildID, err)
+	}
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, playlist := range playlists {
+		if !strings.Contains(strings.ToLower(playlist.Name), typed) {
+			continue
+		}
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: playlist.Name, Value: playlist.Name})
+		if len(choices) == 25 {
+			break
+		}
+	}
+	respondAutocomplete(s, i, choices)
+}
@@ -0,0 +1,183 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	autocompleteMinQueryLength = 3
+	autocompleteDebounce       = 400 * time.Millisecond
+	// Discord drops autocomplete responses after 3 seconds, so leave headroom for the round trip
+	autocompleteResponseTimeout = 2 * time.Second
+	// yt-dlp rarely finishes inside the response window, so the search carries on and the next keystroke gets it from the cache
+	autocompleteSearchTimeout = 15 * time.Second
+	autocompleteCacheTTL      = 10 * time.Minute
+	autocompleteResultCount   = 10
+)
+
+// Raw results are cached since each guild filters them by its own max track length
+type autocompleteCacheEntry struct {
+	videos  []VideoInfo
+	expires time.Time
+}
+
+var (
+	autocompleteMu       sync.Mutex
+	autocompleteCache    = make(map[string]autocompleteCacheEntry)
+	autocompleteSearches = make(map[string]chan struct{})
+	autocompleteRequests = make(map[string]uint64)
+)
+
+func HandlePlayAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !features.Autocomplete {
+		respondAutocomplete(s, i, nil)
+		return
+	}
+	userID := GetUserID(i)
+	deadline := time.Now().Add(autocompleteResponseTimeout)
+
+	var query string
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "query" && option.Focused {
+			query = option.StringValue()
+			break
+		}
+	}
+
+	// Links are played as they are, searching for them only wastes a yt-dlp run
+	key := strings.ToLower(strings.TrimSpace(query))
+	if len(key) < autocompleteMinQueryLength || isYouTubeLink(key) || isMusicServiceLink(key) {
+		respondAutocomplete(s, i, nil)
+		return
+	}
+
+	maxTrackLength := GlobalSettings.Get(i.GuildID).MaxTrackLength
+	if videos, ok := getCachedAutocomplete(key); ok {
+		respondAutocomplete(s, i, autocompleteChoices(query, videos, maxTrackLength))
+		return
+	}
+
+	// Discord sends an autocomplete request for every keystroke, so only search for the latest one
+	autocompleteMu.Lock()
+	autocompleteRequests[userID]++
+	request := autocompleteRequests[userID]
+	autocompleteMu.Unlock()
+	defer func() {
+		autocompleteMu.Lock()
+		if autocompleteRequests[userID] == request {
+			delete(autocompleteRequests, userID)
+		}
+		autocompleteMu.Unlock()
+	}()
+
+	time.Sleep(autocompleteDebounce)
+
+	autocompleteMu.Lock()
+	superseded := autocompleteRequests[userID] != request
+	autocompleteMu.Unlock()
+	if superseded {
+		respondAutocomplete(s, i, nil)
+		return
+	}
+
+	select {
+	case <-startAutocompleteSearch(key, query):
+	case <-time.After(time.Until(deadline)):
+		respondAutocomplete(s, i, nil)
+		return
+	}
+
+	videos, _ := getCachedAutocomplete(key)
+	respondAutocomplete(s, i, autocompleteChoices(query, videos, maxTrackLength))
+}
+
+// Runs at most one search per query and returns a channel that's closed once its results are cached
+func startAutocompleteSearch(key, query string) <-chan struct{} {
+	autocompleteMu.Lock()
+	defer autocompleteMu.Unlock()
+	if done, ok := autocompleteSearches[key]; ok {
+		return done
+	}
+	done := make(chan struct{})
+	autocompleteSearches[key] = done
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), autocompleteSearchTimeout)
+		defer cancel()
+		results, err := YoutubeSearchContext(ctx, query, autocompleteResultCount)
+		if err != nil {
+			logWarnf("Autocomplete search failed for %q: %v", query, err)
+		} else {
+			setCachedAutocomplete(key, results.Videos)
+		}
+
+		autocompleteMu.Lock()
+		delete(autocompleteSearches, key)
+		autocompleteMu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+func autocompleteChoices(query string, videos []VideoInfo, maxTrackLength time.Duration) []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, video := range RankSearchResults(query, videos, maxTrackLength) {
+		// Choice values are capped at 100 characters, which a canonical watch URL always fits in
+		if video.WebURL == "" || len(video.WebURL) > 100 {
+			continue
+		}
+		duration := fmtDuration(time.Duration(video.Duration) * time.Second)
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  truncateRunes(fmt.Sprintf("%s (%s)", video.Title, duration), 100),
+			Value: video.WebURL,
+		})
+		if len(choices) == 25 {
+			break
+		}
+	}
+	return choices
+}
+
+func getCachedAutocomplete(key string) ([]VideoInfo, bool) {
+	autocompleteMu.Lock()
+	defer autocompleteMu.Unlock()
+	entry, ok := autocompleteCache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.videos, true
+}
+
+func setCachedAutocomplete(key string, videos []VideoInfo) {
+	autocompleteMu.Lock()
+	defer autocompleteMu.Unlock()
+
+	now := time.Now()
+	for k, entry := range autocompleteCache {
+		if now.After(entry.expires) {
+			delete(autocompleteCache, k)
+		}
+	}
+	autocompleteCache[key] = autocompleteCacheEntry{videos: videos, expires: now.Add(autocompleteCacheTTL)}
+}
+
+func respondAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate, choices []*discordgo.ApplicationCommandOptionChoice) {
+	if choices == nil {
+		choices = []*discordgo.ApplicationCommandOptionChoice{}
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+	if err != nil {
+		logWarnf("Failed to respond to autocomplete: %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -14,11 +15,19 @@ var BotToken string
 var ErrorChan = make(chan GuildError)
 
 const BotTextChannelName = "music-bot-channel"
-const CacheDir = "/tmp/discordmusicbot"
-const cleanupFrequency = 1 * time.Hour
-const maxFileAge = 6 * time.Hour
 
-var botTextChannels = make(map[string]string)
+// Overridden by ApplyConfig
+var (
+	CacheDir         = "/tmp/discordmusicbot"
+	cleanupFrequency = 1 * time.Hour
+	maxFileAge       = 6 * time.Hour
+	maxCacheSize     int64
+)
+
+var (
+	botTextChannelsMu sync.Mutex
+	botTextChannels   = make(map[string]string)
+)
 
 type GuildError struct {
 	GuildID string
@@ -34,6 +43,11 @@ func Run() {
 	discord, err := discordgo.New("Bot " + BotToken)
 	CheckNilErr(err)
 
+	GlobalStore, err = OpenStore(DatabasePath)
+	CheckNilErr(err)
+	defer GlobalStore.Close()
+	CheckNilErr(GlobalSettings.Load(GlobalStore))
+
 	ready := make(chan struct{})
 	discord.AddHandlerOnce(func(s *discordgo.Session, r *discordgo.Ready) {
 		close(ready)
@@ -44,6 +58,9 @@ func Run() {
 
 	discord.AddHandler(Message)
 	discord.AddHandler(Interaction)
+	discord.AddHandler(VoiceStateUpdate)
+	discord.AddHandler(GuildCreate)
+	discord.AddHandler(GuildDelete)
 
 	err = discord.Open()
 	CheckNilErr(err)
@@ -51,54 +68,15 @@ func Run() {
 
 	<-ready
 
-	botID := discord.State.User.ID
-	for _, guild := range discord.State.Guilds {
-		existingCmds, err := discord.ApplicationCommands(botID, guild.ID)
-		CheckNilErr(err)
-
-		existingNames := make(map[string]*discordgo.ApplicationCommand)
-		for _, cmd := range existingCmds {
-			existingNames[cmd.Name] = cmd
-		}
-
-		configNames := make(map[string]bool)
-		for _, cmd := range SlashCommands {
-			configNames[cmd.Command.Name] = true
-		}
-
-		for name, cmd := range existingNames {
-			if !configNames[name] {
-				err := discord.ApplicationCommandDelete(botID, guild.ID, cmd.ID)
-				if err != nil {
-					log.Printf("Failed to delete stale command /%s for guild %s: %v", name, guild.ID, err)
-				} else {
-					log.Printf("Deleted stale command /%s for guild %s", name, guild.ID)
-				}
-			}
-		}
-
-		for _, cmd := range SlashCommands {
-			if _, exists := existingNames[cmd.Command.Name]; exists {
-				continue
-			}
-			_, err := discord.ApplicationCommandCreate(botID, guild.ID, cmd.Command)
-			if err != nil {
-				log.Printf("Failed to create command /%s for guild %s: %v", cmd.Command.Name, guild.ID, err)
-			} else {
-				log.Printf("Registered /%s for guild %s", cmd.Command.Name, guild.ID)
-			}
-		}
-	}
-
-	StartCleanupRoutine(CacheDir, cleanupFrequency, maxFileAge)
+	StartCleanupRoutine(CacheDir, cleanupFrequency, maxFileAge, maxCacheSize)
 
 	go func() {
 		for guildErr := range ErrorChan {
-			log.Printf("Bot error in guild %s: %v", guildErr.GuildID, guildErr.Err)
+			logErrorf("Bot error in guild %s: %v", guildErr.GuildID, guildErr.Err)
 
-			channelID, ok := botTextChannels[guildErr.GuildID]
+			channelID, ok := BotTextChannel(guildErr.GuildID)
 			if !ok {
-				log.Printf("No bot text channel recorded for guild %s to send error message", guildErr.GuildID)
+				logWarnf("No bot text channel recorded for guild %s to send error message", guildErr.GuildID)
 				continue
 			}
 
@@ -110,25 +88,35 @@ func Run() {
 
 			_, sendErr := discord.ChannelMessageSendEmbed(channelID, embed)
 			if sendErr != nil {
-				log.Printf("Failed to send error message to channel %s in guild %s: %v", channelID, guildErr.GuildID, sendErr)
+				logWarnf("Failed to send error message to channel %s in guild %s: %v", channelID, guildErr.GuildID, sendErr)
 			}
 		}
 	}()
 
-	err = InitializeBotChannels(discord)
+	// Guilds that already arrived through GuildCreate are skipped
+	err = SetupGuilds(discord)
 	if err != nil {
-		log.Printf("Failed to initialize bot channels: %v", err)
+		logErrorf("Failed to set up guilds: %v", err)
 		ErrorChan <- GuildError{
 			GuildID: discord.State.Application.GuildID,
-			Err:     fmt.Errorf("failed to initialize bot channels: %v", err),
+			Err:     fmt.Errorf("failed to set up guilds: %v", err),
 		}
 	}
 
-	log.Println("Bot running...")
+	if features.SessionResume {
+		RestoreSessions(discord)
+		StartSessionSaver(sessionSaveInterval)
+	}
+	RestoreAlwaysOn(discord)
+
+	logInfof("Bot running...")
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 	<-c
 
+	if features.SessionResume {
+		SaveSessions()
+	}
 	close(ErrorChan)
 }
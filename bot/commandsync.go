@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Set by ApplyConfig, only logs what the sync would change
+var commandSyncDryRun bool
+
+// The parts of a command Discord stores for us. Registered commands come back with IDs, versions and
+// defaults filled in, so both sides are reduced to this before comparing.
+type commandSpec struct {
+	Name                     string
+	Description              string
+	Type                     discordgo.ApplicationCommandType
+	DefaultMemberPermissions int64
+	HasDefaultPermissions    bool
+	Options                  []optionSpec
+}
+
+type optionSpec struct {
+	Type         discordgo.ApplicationCommandOptionType
+	Name         string
+	Description  string
+	Required     bool
+	Autocomplete bool
+	Choices      []string
+	ChannelTypes []discordgo.ChannelType
+	MinValue     string
+	MaxValue     float64
+	MinLength    int
+	MaxLength    int
+	Options      []optionSpec
+}
+
+func newCommandSpec(cmd *discordgo.ApplicationCommand) commandSpec {
+	spec := commandSpec{
+		Name:        cmd.Name,
+		Description: cmd.Description,
+		Type:        cmd.Type,
+		Options:     newOptionSpecs(cmd.Options),
+	}
+	if spec.Type == 0 {
+		spec.Type = discordgo.ChatApplicationCommand
+	}
+	if cmd.DefaultMemberPermissions != nil {
+		spec.HasDefaultPermissions = true
+		spec.DefaultMemberPermissions = *cmd.DefaultMemberPermissions
+	}
+	return spec
+}
+
+func newOptionSpecs(options []*discordgo.ApplicationCommandOption) []optionSpec {
+	var specs []optionSpec
+	for _, option := range options {
+		spec := optionSpec{
+			Type:         option.Type,
+			Name:         option.Name,
+			Description:  option.Description,
+			Required:     option.Required,
+			Autocomplete: option.Autocomplete,
+			ChannelTypes: slices.Sorted(slices.Values(option.ChannelTypes)),
+			MaxValue:     option.MaxValue,
+			MaxLength:    option.MaxLength,
+			Options:      newOptionSpecs(option.Options),
+		}
+		// Choice values come back from Discord as float64 even when they were sent as ints
+		for _, choice := range option.Choices {
+			spec.Choices = append(spec.Choices, fmt.Sprintf("%s=%v", choice.Name, choice.Value))
+		}
+		if option.MinValue != nil {
+			spec.MinValue = fmt.Sprint(*option.MinValue)
+		}
+		if option.MinLength != nil {
+			spec.MinLength = *option.MinLength
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// Lists which parts of a command changed, for the sync log
+func describeCommandChange(old, new commandSpec) string {
+	var changed []string
+	if old.Description != new.Description {
+		changed = append(changed, "description")
+	}
+	if old.Type != new.Type {
+		changed = append(changed, "type")
+	}
+	if old.HasDefaultPermissions != new.HasDefaultPermissions || old.DefaultMemberPermissions != new.DefaultMemberPermissions {
+		changed = append(changed, "permissions")
+	}
+	if !reflect.DeepEqual(old.Options, new.Options) {
+		changed = append(changed, "options")
+	}
+	return strings.Join(changed, ", ")
+}
+
+// Compares the guild's registered commands with SlashCommands and, if anything differs, replaces them
+// all with one bulk overwrite. Commands that didn't change keep their IDs.
+func SyncCommands(discord *discordgo.Session, guildID string) error {
+	appID := discord.State.User.ID
+	registered, err := discord.ApplicationCommands(appID, guildID)
+	if err != nil {
+		return fmt.Errorf("failed to list commands: %w", err)
+	}
+
+	existing := make(map[string]commandSpec)
+	for _, cmd := range registered {
+		existing[cmd.Name] = newCommandSpec(cmd)
+	}
+
+	var names []string
+	for name := range SlashCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []string
+	var desired []*discordgo.ApplicationCommand
+	for _, name := range names {
+		cmd := SlashCommands[name].Command
+		desired = append(desired, cmd)
+
+		want := newCommandSpec(cmd)
+		have, ok := existing[cmd.Name]
+		switch {
+		case !ok:
+			changes = append(changes, "+ /"+cmd.Name)
+		case !reflect.DeepEqual(have, want):
+			changes = append(changes, fmt.Sprintf("~ /%s (%s)", cmd.Name, describeCommandChange(have, want)))
+		}
+		delete(existing, cmd.Name)
+	}
+	for name := range existing {
+		changes = append(changes, "- /"+name)
+	}
+
+	if len(changes) == 0 {
+		logDebugf("Commands for guild %s are up to date", guildID)
+		return nil
+	}
+	sort.SliceStable(changes, func(a, b int) bool { return changes[a][2:] < changes[b][2:] })
+
+	if commandSyncDryRun {
+		logInfof("Dry run, would update commands for guild %s:\n  %s", guildID, strings.Join(changes, "\n  "))
+		return nil
+	}
+	if _, err := discord.ApplicationCommandBulkOverwrite(appID, guildID, desired); err != nil {
+		return fmt.Errorf("failed to overwrite commands: %w", err)
+	}
+	logInfof("Updated commands for guild %s:\n  %s", guildID, strings.Join(changes, "\n  "))
+	return nil
+}
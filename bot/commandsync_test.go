@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestNewCommandSpec(t *testing.T) {
+	minPosition := float64(1)
+	minLength := 2
+	managePermission := int64(discordgo.PermissionManageGuild)
+
+	local := &discordgo.ApplicationCommand{
+		Name:                     "example",
+		Description:              "An example command",
+		DefaultMemberPermissions: &managePermission,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "move",
+				Description: "Move a track",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "position",
+						Description: "Where to",
+						Required:    true,
+						MinValue:    &minPosition,
+						MaxValue:    100,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "volume",
+						Description: "How loud",
+						Choices: []*discordgo.ApplicationCommandOptionChoice{
+							{Name: "quiet", Value: 25},
+							{Name: "loud", Value: 100},
+						},
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "Where to play",
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildStageVoice, discordgo.ChannelTypeGuildVoice},
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "query",
+						Description:  "What to play",
+						Autocomplete: true,
+						MinLength:    &minLength,
+						MaxLength:    200,
+					},
+				},
+			},
+		},
+	}
+
+	// What Discord sends back for the same command, with IDs and versions filled in, permissions as a
+	// string, numbers as floats and channel types in its own order
+	registered := `{
+		"id": "1",
+		"application_id": "2",
+		"guild_id": "3",
+		"version": "4",
+		"type": 1,
+		"name": "example",
+		"description": "An example command",
+		"default_member_permissions": "32",
+		"nsfw": false,
+		"options": [{
+			"type": 1,
+			"name": "move",
+			"description": "Move a track",
+			"options": [
+				{"type": 4, "name": "position", "description": "Where to", "required": true, "min_value": 1, "max_value": 100},
+				{"type": 4, "name": "volume", "description": "How loud", "choices": [{"name": "quiet", "value": 25}, {"name": "loud", "value": 100}]},
+				{"type": 7, "name": "channel", "description": "Where to play", "channel_types": [2, 13]},
+				{"type": 3, "name": "query", "description": "What to play", "autocomplete": true, "min_length": 2, "max_length": 200}
+			]
+		}]
+	}`
+
+	parse := func(t *testing.T, data string) *discordgo.ApplicationCommand {
+		t.Helper()
+		var cmd discordgo.ApplicationCommand
+		if err := json.Unmarshal([]byte(data), &cmd); err != nil {
+			t.Fatalf("failed to parse registered command: %v", err)
+		}
+		return &cmd
+	}
+
+	tests := []struct {
+		name        string
+		registered  string
+		wantEqual   bool
+		wantChanged string
+	}{
+		{
+			name:       "unchanged",
+			registered: registered,
+			wantEqual:  true,
+		},
+		{
+			name:        "description changed",
+			registered:  `{"type": 1, "name": "example", "description": "Old description", "default_member_permissions": "32", "options": ` + optionsJSON(t, registered) + `}`,
+			wantChanged: "description",
+		},
+		{
+			name:        "permissions dropped",
+			registered:  `{"type": 1, "name": "example", "description": "An example command", "options": ` + optionsJSON(t, registered) + `}`,
+			wantChanged: "permissions",
+		},
+		{
+			name:        "autocomplete missing",
+			registered:  `{"type": 1, "name": "example", "description": "An example command", "default_member_permissions": "32", "options": [{"type": 1, "name": "move", "description": "Move a track", "options": [{"type": 4, "name": "position", "description": "Where to", "required": true, "min_value": 1, "max_value": 100}, {"type": 4, "name": "volume", "description": "How loud", "choices": [{"name": "quiet", "value": 25}, {"name": "loud", "value": 100}]}, {"type": 7, "name": "channel", "description": "Where to play", "channel_types": [2, 13]}, {"type": 3, "name": "query", "description": "What to play", "min_length": 2, "max_length": 200}]}]}`,
+			wantChanged: "options",
+		},
+		{
+			name:        "choice value changed",
+			registered:  `{"type": 1, "name": "example", "description": "An example command", "default_member_permissions": "32", "options": [{"type": 1, "name": "move", "description": "Move a track", "options": [{"type": 4, "name": "position", "description": "Where to", "required": true, "min_value": 1, "max_value": 100}, {"type": 4, "name": "volume", "description": "How loud", "choices": [{"name": "quiet", "value": 20}, {"name": "loud", "value": 100}]}, {"type": 7, "name": "channel", "description": "Where to play", "channel_types": [2, 13]}, {"type": 3, "name": "query", "description": "What to play", "autocomplete": true, "min_length": 2, "max_length": 200}]}]}`,
+			wantChanged: "options",
+		},
+		{
+			name:        "min value missing",
+			registered:  `{"type": 1, "name": "example", "description": "An example command", "default_member_permissions": "32", "options": [{"type": 1, "name": "move", "description": "Move a track", "options": [{"type": 4, "name": "position", "description": "Where to", "required": true, "max_value": 100}, {"type": 4, "name": "volume", "description": "How loud", "choices": [{"name": "quiet", "value": 25}, {"name": "loud", "value": 100}]}, {"type": 7, "name": "channel", "description": "Where to play", "channel_types": [2, 13]}, {"type": 3, "name": "query", "description": "What to play", "autocomplete": true, "min_length": 2, "max_length": 200}]}]}`,
+			wantChanged: "options",
+		},
+	}
+
+	want := newCommandSpec(local)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			have := newCommandSpec(parse(t, tt.registered))
+			if equal := reflect.DeepEqual(have, want); equal != tt.wantEqual {
+				t.Fatalf("specs equal = %v, want %v\nregistered: %+v\nlocal:      %+v", equal, tt.wantEqual, have, want)
+			}
+			if got := describeCommandChange(have, want); got != tt.wantChanged {
+				t.Errorf("describeCommandChange() = %q, want %q", got, tt.wantChanged)
+			}
+		})
+	}
+}
+
+// Every command the bot defines has to look unchanged once it comes back from Discord, or each startup
+// would overwrite them all
+func TestSlashCommandsRoundTrip(t *testing.T) {
+	for name, cmd := range SlashCommands {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(cmd.Command)
+			if err != nil {
+				t.Fatalf("failed to encode command: %v", err)
+			}
+			var registered discordgo.ApplicationCommand
+			if err := json.Unmarshal(data, &registered); err != nil {
+				t.Fatalf("failed to decode command: %v", err)
+			}
+			have, want := newCommandSpec(&registered), newCommandSpec(cmd.Command)
+			if !reflect.DeepEqual(have, want) {
+				t.Errorf("round trip changed the command (%s)\ngot:  %+v\nwant: %+v", describeCommandChange(have, want), have, want)
+			}
+		})
+	}
+}
+
+func optionsJSON(t *testing.T, command string) string {
+	t.Helper()
+	var raw struct {
+		Options json.RawMessage `json:"options"`
+	}
+	if err := json.Unmarshal([]byte(command), &raw); err != nil {
+		t.Fatalf("failed to read options: %v", err)
+	}
+	return string(raw.Options)
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
@@ -26,32 +27,21 @@ func GetUserID(i *discordgo.InteractionCreate) string {
 	return ""
 }
 
-func InitializeBotChannels(discord *discordgo.Session) error {
-	guilds, err := discord.UserGuilds(100, "", "", false)
-	if err != nil {
-		return fmt.Errorf("failed to get bot guilds: %w", err)
+// The music channel setting wins over the channel picked at startup
+func BotTextChannel(guildID string) (string, bool) {
+	if musicChannelID := GlobalSettings.Get(guildID).MusicChannelID; musicChannelID != "" {
+		return musicChannelID, true
 	}
+	botTextChannelsMu.Lock()
+	defer botTextChannelsMu.Unlock()
+	channelID, ok := botTextChannels[guildID]
+	return channelID, ok
+}
 
-	for _, g := range guilds {
-		channelID, err := GetOrCreateBotChannel(discord, g.ID)
-		if err != nil {
-			log.Printf("Error initializing bot channel for guild %s: %v", g.ID, err)
-			ErrorChan <- GuildError{
-				GuildID: g.ID,
-				Err:     err,
-			}
-
-			// Send fallback message on the resolved channel if possible
-			if channelID != "" {
-				msg := "⚠️ I couldn't create my dedicated channel due to missing permissions. Using a fallback channel instead. Please grant me the 'Manage Channels' permission."
-				_, sendErr := discord.ChannelMessageSend(channelID, msg)
-				if sendErr != nil {
-					log.Printf("Failed to send fallback message in guild %s channel %s: %v", g.ID, channelID, sendErr)
-				}
-			}
-		}
-	}
-	return nil
+func setBotTextChannel(guildID, channelID string) {
+	botTextChannelsMu.Lock()
+	defer botTextChannelsMu.Unlock()
+	botTextChannels[guildID] = channelID
 }
 
 func GetOrCreateBotChannel(discord *discordgo.Session, guildID string) (string, error) {
@@ -60,10 +50,21 @@ func GetOrCreateBotChannel(discord *discordgo.Session, guildID string) (string,
 		return "", fmt.Errorf("failed to get channels for guild %s: %w", guildID, err)
 	}
 
+	// 0. Use the music channel the server picked in /settings
+	if musicChannelID := GlobalSettings.Get(guildID).MusicChannelID; musicChannelID != "" {
+		for _, ch := range channels {
+			if ch.ID == musicChannelID && ch.Type == discordgo.ChannelTypeGuildText {
+				setBotTextChannel(guildID, ch.ID)
+				return ch.ID, nil
+			}
+		}
+		logInfof("Music channel %s for guild %s no longer exists, picking another", musicChannelID, guildID)
+	}
+
 	// 1. Look for bot text channel
 	for _, ch := range channels {
 		if ch.Type == discordgo.ChannelTypeGuildText && ch.Name == BotTextChannelName {
-			botTextChannels[guildID] = ch.ID
+			setBotTextChannel(guildID, ch.ID)
 			return ch.ID, nil
 		}
 	}
@@ -71,7 +72,7 @@ func GetOrCreateBotChannel(discord *discordgo.Session, guildID string) (string,
 	// 2. Try to find "general" text channel
 	for _, ch := range channels {
 		if ch.Type == discordgo.ChannelTypeGuildText && ch.Name == "general" {
-			botTextChannels[guildID] = ch.ID
+			setBotTextChannel(guildID, ch.ID)
 			return ch.ID, nil
 		}
 	}
@@ -79,7 +80,7 @@ func GetOrCreateBotChannel(discord *discordgo.Session, guildID string) (string,
 	// 3. Fallback to first text channel
 	for _, ch := range channels {
 		if ch.Type == discordgo.ChannelTypeGuildText {
-			botTextChannels[guildID] = ch.ID
+			setBotTextChannel(guildID, ch.ID)
 			return ch.ID, nil
 		}
 	}
@@ -90,13 +91,13 @@ func GetOrCreateBotChannel(discord *discordgo.Session, guildID string) (string,
 		// Creation failed, try again to fallback (in case channels appeared meanwhile)
 		for _, ch := range channels {
 			if ch.Type == discordgo.ChannelTypeGuildText && ch.Name == "general" {
-				botTextChannels[guildID] = ch.ID
+				setBotTextChannel(guildID, ch.ID)
 				return ch.ID, fmt.Errorf("failed to create bot channel: %w (falling back to general)", err)
 			}
 		}
 		for _, ch := range channels {
 			if ch.Type == discordgo.ChannelTypeGuildText {
-				botTextChannels[guildID] = ch.ID
+				setBotTextChannel(guildID, ch.ID)
 				return ch.ID, fmt.Errorf("failed to create bot channel: %w (falling back to first text channel)", err)
 			}
 		}
@@ -104,11 +105,12 @@ func GetOrCreateBotChannel(discord *discordgo.Session, guildID string) (string,
 		return "", fmt.Errorf("failed to create bot channel and no fallback channel found: %w", err)
 	}
 
-	botTextChannels[guildID] = channel.ID
+	setBotTextChannel(guildID, channel.ID)
 	return channel.ID, nil
 }
 
-func StartCleanupRoutine(dir string, interval time.Duration, maxFileAge time.Duration) {
+// maxSize of 0 means the cache can grow as large as it likes
+func StartCleanupRoutine(dir string, interval time.Duration, maxFileAge time.Duration, maxSize int64) {
 	go func() {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
@@ -118,16 +120,17 @@ func StartCleanupRoutine(dir string, interval time.Duration, maxFileAge time.Dur
 
 			files, err := os.ReadDir(dir)
 			if err != nil {
-				log.Printf("Cleanup: failed to read dir %s: %v", dir, err)
+				logWarnf("Cleanup: failed to read dir %s: %v", dir, err)
 				continue
 			}
 
 			now := time.Now()
+			var kept []os.FileInfo
 			for _, file := range files {
 				path := filepath.Join(dir, file.Name())
 				info, err := file.Info()
 				if err != nil {
-					log.Printf("Cleanup: failed to get info for %s: %v", path, err)
+					logWarnf("Cleanup: failed to get info for %s: %v", path, err)
 					continue
 				}
 
@@ -135,12 +138,48 @@ func StartCleanupRoutine(dir string, interval time.Duration, maxFileAge time.Dur
 				if now.Sub(info.ModTime()) > maxFileAge {
 					err := os.Remove(path)
 					if err != nil {
-						log.Printf("Cleanup: failed to remove file %s: %v", path, err)
+						logWarnf("Cleanup: failed to remove file %s: %v", path, err)
 					} else {
-						log.Printf("Cleanup: removed old file %s", path)
+						logDebugf("Cleanup: removed old file %s", path)
 					}
+					continue
 				}
+				kept = append(kept, info)
+			}
+
+			if maxSize > 0 {
+				trimCache(dir, kept, maxSize)
 			}
 		}
 	}()
 }
+
+// Removes the oldest files until the cache fits, leaving anything that's queued or playing alone
+func trimCache(dir string, files []os.FileInfo, maxSize int64) {
+	var total int64
+	for _, info := range files {
+		total += info.Size()
+	}
+	if total <= maxSize {
+		return
+	}
+
+	sort.Slice(files, func(a, b int) bool {
+		return files[a].ModTime().Before(files[b].ModTime())
+	})
+	for _, info := range files {
+		if total <= maxSize {
+			return
+		}
+		path := filepath.Join(dir, info.Name())
+		if GlobalQueue.FileInUse(path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			logWarnf("Cleanup: failed to remove file %s: %v", path, err)
+			continue
+		}
+		total -= info.Size()
+		logDebugf("Cleanup: removed %s to keep the cache under %d MB", path, maxSize>>20)
+	}
+}
@@ -0,0 +1,266 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultConfigPath = "config.yaml"
+
+type Config struct {
+	Token               string         `yaml:"token"`
+	CacheDir            string         `yaml:"cache_dir"`
+	CacheMaxSizeMB      int            `yaml:"cache_max_size_mb"`
+	CleanupInterval     time.Duration  `yaml:"cleanup_interval"`
+	MaxFileAge          time.Duration  `yaml:"max_file_age"`
+	DatabasePath        string         `yaml:"database_path"`
+	YtDlpPath           string         `yaml:"ytdlp_path"`
+	FFmpegPath          string         `yaml:"ffmpeg_path"`
+	LogLevel            string         `yaml:"log_level"`
+	DownloadConcurrency int            `yaml:"download_concurrency"`
+	CommandSyncDryRun   bool           `yaml:"command_sync_dry_run"`
+	Defaults            DefaultsConfig `yaml:"defaults"`
+	Features            FeaturesConfig `yaml:"features"`
+}
+
+// Starting values for every guild's /settings
+type DefaultsConfig struct {
+	MaxTrackLength   time.Duration `yaml:"max_track_length"`
+	MaxTracksPerUser int           `yaml:"max_tracks_per_user"`
+	MaxQueueLength   int           `yaml:"max_queue_length"`
+	VoteSkipPercent  int           `yaml:"vote_skip_percent"`
+	Volume           int           `yaml:"volume"`
+	IdleTimeout      time.Duration `yaml:"idle_timeout"`
+	AloneTimeout     time.Duration `yaml:"alone_timeout"`
+	AutoPause        bool          `yaml:"auto_pause"`
+	DuplicatePolicy  string        `yaml:"duplicates"`
+}
+
+type FeaturesConfig struct {
+	Autocomplete  bool `yaml:"autocomplete"`
+	MusicLinks    bool `yaml:"music_links"`
+	Playlists     bool `yaml:"playlists"`
+	SessionResume bool `yaml:"session_resume"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		CacheDir:            "/tmp/discordmusicbot",
+		CacheMaxSizeMB:      2048,
+		CleanupInterval:     1 * time.Hour,
+		MaxFileAge:          6 * time.Hour,
+		DatabasePath:        "data/musicbot.db",
+		YtDlpPath:           "yt-dlp",
+		FFmpegPath:          "ffmpeg",
+		LogLevel:            "info",
+		DownloadConcurrency: 3,
+		Defaults: DefaultsConfig{
+			MaxTrackLength:   1 * time.Hour,
+			MaxTracksPerUser: 0,
+			MaxQueueLength:   0,
+			VoteSkipPercent:  50,
+			Volume:           defaultVolume,
+			IdleTimeout:      10 * time.Minute,
+			AloneTimeout:     2 * time.Minute,
+			AutoPause:        true,
+			DuplicatePolicy:  string(DuplicateWarn),
+		},
+		Features: FeaturesConfig{
+			Autocomplete:  true,
+			MusicLinks:    true,
+			Playlists:     true,
+			SessionResume: true,
+		},
+	}
+}
+
+type envOverride struct {
+	Name  string
+	Apply func(cfg *Config, value string) error
+}
+
+var envOverrides = []envOverride{
+	{"DISCORD_BOT_TOKEN", func(cfg *Config, v string) error { cfg.Token = v; return nil }},
+	{"MUSICBOT_CACHE_DIR", func(cfg *Config, v string) error { cfg.CacheDir = v; return nil }},
+	{"MUSICBOT_CACHE_MAX_SIZE_MB", func(cfg *Config, v string) error { return parseEnvInt(v, &cfg.CacheMaxSizeMB) }},
+	{"MUSICBOT_DATABASE_PATH", func(cfg *Config, v string) error { cfg.DatabasePath = v; return nil }},
+	{"MUSICBOT_YTDLP_PATH", func(cfg *Config, v string) error { cfg.YtDlpPath = v; return nil }},
+	{"MUSICBOT_FFMPEG_PATH", func(cfg *Config, v string) error { cfg.FFmpegPath = v; return nil }},
+	{"MUSICBOT_LOG_LEVEL", func(cfg *Config, v string) error { cfg.LogLevel = v; return nil }},
+	{"MUSICBOT_DOWNLOAD_CONCURRENCY", func(cfg *Config, v string) error { return parseEnvInt(v, &cfg.DownloadConcurrency) }},
+}
+
+func parseEnvInt(value string, target *int) error {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("expected a whole number, got %q", value)
+	}
+	*target = n
+	return nil
+}
+
+// Builds the config from the defaults, then the config file, then environment variables. An empty path
+// reads config.yaml if there is one, an explicit path has to exist.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+
+	explicit := path != ""
+	if !explicit {
+		path = DefaultConfigPath
+	}
+	file, err := os.Open(path)
+	switch {
+	case err == nil:
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		err = decoder.Decode(&cfg)
+		file.Close()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+	default:
+		return cfg, fmt.Errorf("failed to open config file: %w", err)
+	}
+
+	for _, override := range envOverrides {
+		value, ok := os.LookupEnv(override.Name)
+		if !ok || value == "" {
+			continue
+		}
+		if err := override.Apply(&cfg, value); err != nil {
+			return cfg, fmt.Errorf("invalid %s: %w", override.Name, err)
+		}
+	}
+	return cfg, nil
+}
+
+// Reports every problem at once so they can all be fixed in one go
+func (cfg Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.Token != "", "token: missing, set DISCORD_BOT_TOKEN or token in the config file")
+	check(cfg.CacheDir != "", "cache_dir: must not be empty")
+	check(cfg.CacheMaxSizeMB >= 0, "cache_max_size_mb: must be 0 (no limit) or more, got %d", cfg.CacheMaxSizeMB)
+	check(cfg.CleanupInterval >= time.Minute, "cleanup_interval: must be at least 1m, got %s", cfg.CleanupInterval)
+	check(cfg.MaxFileAge > 0, "max_file_age: must be positive, got %s", cfg.MaxFileAge)
+	check(cfg.DatabasePath != "", "database_path: must not be empty")
+	check(cfg.DownloadConcurrency >= 1, "download_concurrency: must be at least 1, got %d", cfg.DownloadConcurrency)
+	_, levelErr := parseLogLevel(cfg.LogLevel)
+	check(levelErr == nil, "log_level: %v", levelErr)
+
+	if cfg.CacheDir != "" {
+		err := os.MkdirAll(cfg.CacheDir, 0o755)
+		check(err == nil, "cache_dir: %v", err)
+	}
+	_, err := exec.LookPath(cfg.YtDlpPath)
+	check(err == nil, "ytdlp_path: %q not found, install yt-dlp or point ytdlp_path at it", cfg.YtDlpPath)
+	_, err = exec.LookPath(cfg.FFmpegPath)
+	check(err == nil, "ffmpeg_path: %q not found, install ffmpeg or point ffmpeg_path at it", cfg.FFmpegPath)
+
+	d := cfg.Defaults
+	check(d.MaxTrackLength >= 0, "defaults.max_track_length: must be 0 (no limit) or more, got %s", d.MaxTrackLength)
+	check(d.MaxTracksPerUser >= 0, "defaults.max_tracks_per_user: must be 0 (no limit) or more, got %d", d.MaxTracksPerUser)
+	check(d.MaxQueueLength >= 0, "defaults.max_queue_length: must be 0 (no limit) or more, got %d", d.MaxQueueLength)
+	check(d.VoteSkipPercent >= 0 && d.VoteSkipPercent <= 100, "defaults.vote_skip_percent: must be between 0 and 100, got %d", d.VoteSkipPercent)
+	check(d.Volume >= minVolume && d.Volume <= maxVolume, "defaults.volume: must be between %d and %d, got %d", minVolume, maxVolume, d.Volume)
+	check(d.IdleTimeout >= 0, "defaults.idle_timeout: must be 0 (never) or more, got %s", d.IdleTimeout)
+	check(d.AloneTimeout >= 0, "defaults.alone_timeout: must be 0 (never) or more, got %s", d.AloneTimeout)
+	_, policyErr := parseDuplicatePolicy(d.DuplicatePolicy)
+	check(policyErr == nil, "defaults.duplicates: %v", policyErr)
+
+	return errors.Join(errs...)
+}
+
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("expected debug, info, warn or error, got %q", level)
+}
+
+// The token is left out so the summary is safe to paste into a bug report
+func (cfg Config) Summary() string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "cache_dir: %s (max %s)\n", cfg.CacheDir, fmtCacheSize(cfg.CacheMaxSizeMB))
+	fmt.Fprintf(&builder, "cleanup: every %s, files older than %s\n", cfg.CleanupInterval, cfg.MaxFileAge)
+	fmt.Fprintf(&builder, "database_path: %s\n", cfg.DatabasePath)
+	fmt.Fprintf(&builder, "ytdlp_path: %s\n", cfg.YtDlpPath)
+	fmt.Fprintf(&builder, "ffmpeg_path: %s\n", cfg.FFmpegPath)
+	fmt.Fprintf(&builder, "log_level: %s\n", cfg.LogLevel)
+	fmt.Fprintf(&builder, "download_concurrency: %d\n", cfg.DownloadConcurrency)
+	fmt.Fprintf(&builder, "command_sync_dry_run: %t\n", cfg.CommandSyncDryRun)
+	fmt.Fprintf(&builder, "defaults: %+v\n", cfg.Defaults)
+	fmt.Fprintf(&builder, "features: %+v\n", cfg.Features)
+	return builder.String()
+}
+
+func fmtCacheSize(mb int) string {
+	if mb <= 0 {
+		return "no limit"
+	}
+	return fmt.Sprintf("%d MB", mb)
+}
+
+var features = DefaultConfig().Features
+
+// Must be called before Run
+func ApplyConfig(cfg Config) {
+	level, _ := parseLogLevel(cfg.LogLevel)
+	// Keeps the standard logger's output and only sets which of the bot's leveled lines get through
+	slog.SetLogLoggerLevel(level)
+
+	BotToken = cfg.Token
+	CacheDir = cfg.CacheDir
+	maxCacheSize = int64(cfg.CacheMaxSizeMB) << 20
+	cleanupFrequency = cfg.CleanupInterval
+	maxFileAge = cfg.MaxFileAge
+	DatabasePath = filepath.Clean(cfg.DatabasePath)
+	YtDlpPath = cfg.YtDlpPath
+	FFmpegPath = cfg.FFmpegPath
+	downloadSlots = make(chan struct{}, cfg.DownloadConcurrency)
+	commandSyncDryRun = cfg.CommandSyncDryRun
+	features = cfg.Features
+
+	d := cfg.Defaults
+	policy, _ := parseDuplicatePolicy(d.DuplicatePolicy)
+	guildDefaults = GuildSettings{
+		MaxTrackLength:          d.MaxTrackLength,
+		VoteSkipRatio:           float64(d.VoteSkipPercent) / 100,
+		RequireSameVoiceChannel: true,
+		MaxTracksPerUser:        d.MaxTracksPerUser,
+		MaxQueueLength:          d.MaxQueueLength,
+		DuplicatePolicy:         policy,
+		DefaultVolume:           d.Volume,
+		IdleTimeout:             d.IdleTimeout,
+		AloneTimeout:            d.AloneTimeout,
+		AutoPause:               d.AutoPause,
+	}
+
+	if !features.Playlists {
+		delete(SlashCommands, "playlist")
+	}
+}
@@ -0,0 +1,71 @@
+package bot
+
+import "github.com/bwmarrin/discordgo"
+
+// The command whose permission each panel button needs. Pause, loop and volume have no command of their
+// own, so they follow /skip, restricting /skip restricts every playback control.
+var nowPlayingControlPermissions = map[string]string{
+	"np_skip":        "skip",
+	"np_stop":        "stop",
+	"np_shuffle":     "shuffle",
+	"np_pause":       "skip",
+	"np_loop":        "skip",
+	"np_volume_down": "skip",
+	"np_volume_up":   "skip",
+}
+
+func HandleNowPlayingControl(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guildID := i.GuildID
+	channelID := i.ChannelID
+	customID := i.MessageComponentData().CustomID
+
+	panel, ok := GlobalQueue.GetNowPlayingPanel(guildID)
+	if !ok || i.Message == nil || panel.ID != i.Message.ID {
+		respondEphemeral(s, i, "❌ This control panel is no longer active.")
+		return
+	}
+	if !requireSameVoiceChannel(s, i) {
+		return
+	}
+	if commandName, ok := nowPlayingControlPermissions[customID]; ok && !requireCommandPermission(s, i, commandName) {
+		return
+	}
+
+	switch customID {
+	case "np_skip":
+		HandleSkipCommand(s, i)
+		return
+	case "np_stop":
+		HandleStopCommand(s, i)
+		return
+	case "np_pause":
+		if !GlobalQueue.IsPlaying(guildID) {
+			respondEphemeral(s, i, "⏹️ There's no track currently playing.")
+			return
+		}
+		GlobalQueue.SetPaused(guildID, !GlobalQueue.IsPaused(guildID))
+	case "np_shuffle":
+		GlobalQueue.SetShuffle(channelID, !GlobalQueue.IsShuffleEnabled(channelID))
+	case "np_loop":
+		GlobalQueue.SetLoop(guildID, !GlobalQueue.IsLoopEnabled(guildID))
+	case "np_volume_down":
+		GlobalQueue.SetVolume(guildID, GlobalQueue.GetVolume(guildID)-volumeStep)
+	case "np_volume_up":
+		GlobalQueue.SetVolume(guildID, GlobalQueue.GetVolume(guildID)+volumeStep)
+	default:
+		logWarnf("Unknown now playing control: %v", customID)
+		return
+	}
+
+	current, _ := GlobalQueue.GetCurrentlyPlaying(guildID)
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{buildNowPlayingEmbed(guildID, channelID, current)},
+			Components: buildNowPlayingControls(guildID, channelID, false),
+		},
+	})
+	if err != nil {
+		logWarnf("Failed to update now playing panel in guild %s: %v", guildID, err)
+	}
+}
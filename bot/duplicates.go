@@ -0,0 +1,277 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type DuplicatePolicy string
+
+const (
+	DuplicateAllow  DuplicatePolicy = "allow"
+	DuplicateWarn   DuplicatePolicy = "warn"
+	DuplicateReject DuplicatePolicy = "reject"
+)
+
+const (
+	recentHistorySize      = 20
+	duplicatePromptTimeout = 5 * time.Minute
+	maxDuplicatePrompts    = 25
+)
+
+type DuplicateTrackError struct {
+	Video  VideoInfo
+	Where  string
+	Policy DuplicatePolicy
+}
+
+func (e *DuplicateTrackError) Error() string {
+	return fmt.Sprintf("**%s** %s.", e.Video.Title, e.Where)
+}
+
+type duplicatePrompt struct {
+	ID        string
+	OwnerID   string
+	GuildID   string
+	ChannelID string
+	Tracks    []VideoInfo
+	Queued    []bool
+	CreatedAt time.Time
+}
+
+var (
+	duplicatePromptsMu sync.Mutex
+	duplicatePrompts   = make(map[string]*duplicatePrompt)
+)
+
+// Search results don't always come back with an ID, the URL identifies the video just as well
+func videoKey(video VideoInfo) string {
+	if video.ID != "" {
+		return video.ID
+	}
+	return video.WebURL
+}
+
+func parseDuplicatePolicy(value string) (DuplicatePolicy, error) {
+	switch policy := DuplicatePolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case DuplicateAllow, DuplicateWarn, DuplicateReject:
+		return policy, nil
+	}
+	return "", fmt.Errorf("expected allow, warn or reject, got %q", value)
+}
+
+// Must be called with the queue locked
+func (q *Queue) checkDuplicateLocked(guildID, channelID string, video VideoInfo) error {
+	policy := GlobalSettings.Get(guildID).DuplicatePolicy
+	if policy == DuplicateAllow {
+		return nil
+	}
+
+	key := videoKey(video)
+	where := ""
+	if current, ok := q.currentlyPlaying[guildID]; ok && current.WebURL != "" && videoKey(current) == key {
+		where = "is playing right now"
+	}
+	if where == "" && (containsVideo(q.queues[channelID], key) || containsVideo(q.pending[channelID], key)) {
+		where = "is already in the queue"
+	}
+	if where == "" && containsVideo(q.history[guildID], key) {
+		where = "was played recently"
+	}
+
+	if where == "" {
+		return nil
+	}
+	return &DuplicateTrackError{Video: video, Where: where, Policy: policy}
+}
+
+func containsVideo(videos []VideoInfo, key string) bool {
+	for _, item := range videos {
+		if videoKey(item) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Queue) RecordPlayed(guildID string, video VideoInfo) {
+	q.Lock()
+	defer q.Unlock()
+	history := append(q.history[guildID], video)
+	if len(history) > recentHistorySize {
+		history = history[len(history)-recentHistorySize:]
+	}
+	q.history[guildID] = history
+}
+
+// Whether another queue entry still needs the downloaded file for this title
+func (q *Queue) IsTitleQueued(channelID, title string) bool {
+	q.Lock()
+	defer q.Unlock()
+	for _, items := range [][]VideoInfo{q.queues[channelID], q.pending[channelID]} {
+		for _, item := range items {
+			if item.Title == title {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Posts a warning listing the duplicates with a button for each so the requester can queue them anyway
+func sendDuplicatePrompt(discord *discordgo.Session, i *discordgo.InteractionCreate, userID string, duplicates []*DuplicateTrackError) {
+	if len(duplicates) == 0 {
+		return
+	}
+	if len(duplicates) > maxDuplicatePrompts {
+		duplicates = duplicates[:maxDuplicatePrompts]
+	}
+
+	prompt := &duplicatePrompt{
+		ID:        i.ID,
+		OwnerID:   userID,
+		GuildID:   i.GuildID,
+		ChannelID: i.ChannelID,
+		CreatedAt: time.Now(),
+	}
+	var builder strings.Builder
+	for idx, dup := range duplicates {
+		prompt.Tracks = append(prompt.Tracks, dup.Video)
+		fmt.Fprintf(&builder, "**%d.** [%s](%s) %s.\n", idx+1, dup.Video.Title, dup.Video.WebURL, dup.Where)
+	}
+	prompt.Queued = make([]bool, len(prompt.Tracks))
+
+	duplicatePromptsMu.Lock()
+	for id, existing := range duplicatePrompts {
+		if time.Since(existing.CreatedAt) > duplicatePromptTimeout {
+			delete(duplicatePrompts, id)
+		}
+	}
+	duplicatePrompts[prompt.ID] = prompt
+	duplicatePromptsMu.Unlock()
+
+	_, err := discord.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{
+			{
+				Title:       "⚠️ Already Queued",
+				Description: truncateDescription(builder.String()),
+				Color:       0xE03C3C,
+				Footer: &discordgo.MessageEmbedFooter{
+					Text: "These weren't added. Use the buttons below to queue them anyway.",
+				},
+			},
+		},
+		Components: buildDuplicatePromptControls(prompt),
+		Flags:      discordgo.MessageFlagsEphemeral,
+	})
+	if err != nil {
+		logWarnf("Failed to send duplicate warning: %v", err)
+	}
+}
+
+func buildDuplicatePromptControls(prompt *duplicatePrompt) []discordgo.MessageComponent {
+	var rows []discordgo.MessageComponent
+	var buttons []discordgo.MessageComponent
+	for idx := range prompt.Tracks {
+		label := "Queue Anyway"
+		if len(prompt.Tracks) > 1 {
+			label = fmt.Sprintf("Queue #%d Anyway", idx+1)
+		}
+		buttons = append(buttons, discordgo.Button{
+			Label:    label,
+			Style:    discordgo.SecondaryButton,
+			CustomID: fmt.Sprintf("queue_anyway:%s:%d", prompt.ID, idx),
+			Disabled: prompt.Queued[idx],
+		})
+		if len(buttons) == 5 {
+			rows = append(rows, discordgo.ActionsRow{Components: buttons})
+			buttons = nil
+		}
+	}
+	if len(buttons) > 0 {
+		rows = append(rows, discordgo.ActionsRow{Components: buttons})
+	}
+	return rows
+}
+
+func HandleQueueAnywayButton(discord *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := GetUserID(i)
+
+	parts := strings.Split(strings.TrimPrefix(i.MessageComponentData().CustomID, "queue_anyway:"), ":")
+	if len(parts) != 2 {
+		return
+	}
+	idx, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return
+	}
+
+	duplicatePromptsMu.Lock()
+	prompt, ok := duplicatePrompts[parts[0]]
+	if ok && (time.Since(prompt.CreatedAt) > duplicatePromptTimeout || idx < 0 || idx >= len(prompt.Tracks)) {
+		ok = false
+	}
+	duplicatePromptsMu.Unlock()
+	if !ok {
+		respondEphemeral(discord, i, "❌ This prompt has expired. Use /play to add the track again.")
+		return
+	}
+	if prompt.OwnerID != userID {
+		respondEphemeral(discord, i, "❌ Only the person who requested this track can queue it.")
+		return
+	}
+	if !requireSameVoiceChannel(discord, i) {
+		return
+	}
+
+	duplicatePromptsMu.Lock()
+	alreadyQueued := prompt.Queued[idx]
+	prompt.Queued[idx] = true
+	components := buildDuplicatePromptControls(prompt)
+	duplicatePromptsMu.Unlock()
+	if alreadyQueued {
+		respondEphemeral(discord, i, "✅ That track has already been queued.")
+		return
+	}
+
+	// Joining the voice channel can take longer than Discord waits for a response
+	err = discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		logWarnf("Failed to defer queue anyway button: %v", err)
+		return
+	}
+
+	video := prompt.Tracks[idx]
+	if err := GlobalQueue.AddAnyway(discord, i.Interaction, prompt.GuildID, prompt.ChannelID, userID, video); err != nil {
+		duplicatePromptsMu.Lock()
+		prompt.Queued[idx] = false
+		duplicatePromptsMu.Unlock()
+		sendErrorFollowup(discord, i, err.Error())
+		return
+	}
+
+	if _, err := discord.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Components: &components}); err != nil {
+		logWarnf("Failed to update duplicate warning: %v", err)
+	}
+
+	duration := time.Duration(video.Duration) * time.Second
+	sendEmbedFollowup(discord, i, &discordgo.MessageEmbed{
+		Title:       "✅ Added to Queue",
+		Description: fmt.Sprintf("[%s](%s)", video.Title, video.WebURL),
+		Color:       0x1DB954,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Requested By", Value: fmt.Sprintf("<@%s>", userID), Inline: true},
+			{Name: "Duration", Value: fmtDuration(duration), Inline: true},
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Use /queue show to view the current queue.",
+		},
+	})
+}
@@ -0,0 +1,214 @@
+package bot
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Discord's maximum for one page of the bot's guilds
+const guildPageSize = 200
+
+type guildSetupState struct {
+	sync.Mutex
+	done bool
+}
+
+var (
+	guildSetupMu sync.Mutex
+	guildSetup   = make(map[string]*guildSetupState)
+)
+
+// Discord sends this for every guild once the bot connects, when it's added to a new one and when one
+// comes back after an outage
+func GuildCreate(discord *discordgo.Session, g *discordgo.GuildCreate) {
+	if g.Unavailable {
+		return
+	}
+	setupGuild(discord, g.ID)
+}
+
+func GuildDelete(discord *discordgo.Session, g *discordgo.GuildDelete) {
+	// An outage, the bot is still in the guild and gets a GuildCreate once it's back
+	if g.Unavailable {
+		logInfof("Guild %s is unavailable", g.ID)
+		return
+	}
+	logInfof("Removed from guild %s, cleaning up", g.ID)
+	forgetGuild(discord, g.ID)
+}
+
+// Sets up every guild the bot is in, a page at a time
+func SetupGuilds(discord *discordgo.Session) error {
+	after := ""
+	for {
+		guilds, err := discord.UserGuilds(guildPageSize, "", after, false)
+		if err != nil {
+			return fmt.Errorf("failed to get bot guilds: %w", err)
+		}
+		for _, g := range guilds {
+			setupGuild(discord, g.ID)
+		}
+		if len(guilds) < guildPageSize {
+			return nil
+		}
+		after = guilds[len(guilds)-1].ID
+	}
+}
+
+// Registers commands and picks the bot's text channel. Anyone else asking for the same guild waits until
+// it's done. A guild only counts as set up once both worked, otherwise the next GuildCreate tries again.
+func setupGuild(discord *discordgo.Session, guildID string) {
+	guildSetupMu.Lock()
+	state, ok := guildSetup[guildID]
+	if !ok {
+		state = &guildSetupState{}
+		guildSetup[guildID] = state
+	}
+	guildSetupMu.Unlock()
+
+	state.Lock()
+	defer state.Unlock()
+	if state.done {
+		return
+	}
+
+	commandsErr := SyncCommands(discord, guildID)
+	if commandsErr != nil {
+		logWarnf("Failed to sync commands for guild %s: %v", guildID, commandsErr)
+	}
+
+	channelID, err := GetOrCreateBotChannel(discord, guildID)
+	if err != nil {
+		logWarnf("Error initializing bot channel for guild %s: %v", guildID, err)
+		ErrorChan <- GuildError{
+			GuildID: guildID,
+			Err:     err,
+		}
+
+		// Send fallback message on the resolved channel if possible
+		if channelID != "" {
+			msg := "⚠️ I couldn't create my dedicated channel due to missing permissions. Using a fallback channel instead. Please grant me the 'Manage Channels' permission."
+			_, sendErr := discord.ChannelMessageSend(channelID, msg)
+			if sendErr != nil {
+				logWarnf("Failed to send fallback message in guild %s channel %s: %v", guildID, channelID, sendErr)
+			}
+		}
+	}
+
+	// A fallback channel is good enough, retrying would only repeat the warning above
+	state.done = commandsErr == nil && channelID != ""
+}
+
+// Drops everything the bot keeps for a guild it was removed from. Settings and playlists stay in case it's
+// added back, but 24/7 mode is turned off so the bot doesn't keep trying to rejoin.
+func forgetGuild(discord *discordgo.Session, guildID string) {
+	if GlobalSettings.Get(guildID).AlwaysOn {
+		_, err := GlobalSettings.Update(guildID, func(gs *GuildSettings) { gs.AlwaysOn = false })
+		if err != nil {
+			logErrorf("Failed to turn off 24/7 mode for guild %s: %v", guildID, err)
+		}
+	}
+
+	// Collected before leaving, which clears the queue
+	files := GlobalQueue.guildFiles(guildID)
+	GlobalQueue.SetNowPlayingPanel(guildID, nil)
+	if GlobalQueue.IsInVoiceChannel(guildID) {
+		LeaveVoiceChannel(discord, guildID)
+	}
+	cancelIdleTimer(guildID)
+	GlobalQueue.forgetGuild(guildID)
+
+	for _, path := range files {
+		if GlobalQueue.FileInUse(path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logWarnf("Failed to delete file %s: %v", path, err)
+			continue
+		}
+		GlobalQueue.forgetDownloadedFile(path)
+	}
+
+	if features.SessionResume {
+		if err := GlobalStore.Delete(sessionBucket, guildID); err != nil {
+			logErrorf("Failed to delete saved session for guild %s: %v", guildID, err)
+		}
+	}
+
+	botTextChannelsMu.Lock()
+	delete(botTextChannels, guildID)
+	botTextChannelsMu.Unlock()
+
+	// Set up from scratch if the bot is added back
+	guildSetupMu.Lock()
+	delete(guildSetup, guildID)
+	guildSetupMu.Unlock()
+}
+
+// Downloads belonging to the guild's queue, current track and resume point
+func (q *Queue) guildFiles(guildID string) []string {
+	q.Lock()
+	defer q.Unlock()
+	var files []string
+	addFile := func(video VideoInfo) {
+		if path, ok := q.downloadedFiles[video.Title]; ok && video.Title != "" {
+			files = append(files, path)
+		}
+	}
+	for _, video := range q.queues[q.textChannels[guildID]] {
+		addFile(video)
+	}
+	if video, ok := q.currentlyPlaying[guildID]; ok {
+		addFile(video)
+	}
+	if video, ok := q.pausedTrack[guildID]; ok {
+		addFile(video)
+	}
+	if point, ok := q.resumePoints[guildID]; ok {
+		addFile(point.Video)
+	}
+	return files
+}
+
+func (q *Queue) forgetGuild(guildID string) {
+	q.Lock()
+	defer q.Unlock()
+	if textChannelID, ok := q.textChannels[guildID]; ok {
+		delete(q.queues, textChannelID)
+		delete(q.requestedBy, textChannelID)
+		delete(q.pending, textChannelID)
+		delete(q.shuffleMode, textChannelID)
+	}
+	delete(q.textChannels, guildID)
+	delete(q.voiceChannels, guildID)
+	delete(q.voiceConnections, guildID)
+	delete(q.inVoiceChannel, guildID)
+	delete(q.resumePoints, guildID)
+	delete(q.suspended, guildID)
+	delete(q.skipVotes, guildID)
+	delete(q.history, guildID)
+	delete(q.lastActivity, guildID)
+	delete(q.autoPaused, guildID)
+	delete(q.loopEnabled, guildID)
+	delete(q.volume, guildID)
+	delete(q.currentlyPlaying, guildID)
+	delete(q.position, guildID)
+	delete(q.paused, guildID)
+	delete(q.pausedTrack, guildID)
+	delete(q.playing, guildID)
+	delete(q.nowPlayingPanels, guildID)
+}
+
+// Drops every title that points at a file that was deleted
+func (q *Queue) forgetDownloadedFile(path string) {
+	q.Lock()
+	defer q.Unlock()
+	for title, downloaded := range q.downloadedFiles {
+		if downloaded == path {
+			delete(q.downloadedFiles, title)
+		}
+	}
+}
@@ -7,7 +7,13 @@ type ComponentHandler func(s *discordgo.Session, i *discordgo.InteractionCreate)
 var ComponentHandlers = map[string]ComponentHandler{}
 
 func RegisterComponentHandlers() {
-	ComponentHandlers["select_video_"] = HandlePlaySelection
+	ComponentHandlers["select_video:"] = HandlePlaySelection
+	ComponentHandlers["search_page:"] = HandleSearchPage
+	ComponentHandlers["np_"] = HandleNowPlayingControl
+	ComponentHandlers["queue_page:"] = HandleQueuePage
+	ComponentHandlers["skip_vote"] = HandleSkipVoteButton
+	ComponentHandlers["queue_anyway:"] = HandleQueueAnywayButton
+	ComponentHandlers["session_"] = HandleSessionPromptButton
 }
 
 type AutocompleteHandler func(s *discordgo.Session, i *discordgo.InteractionCreate)
@@ -20,4 +26,7 @@ func RegisterAutocompleteHandler(commandName string, handler AutocompleteHandler
 
 func RegisterAutocompleteHandlers() {
 	RegisterAutocompleteHandler("shuffle", HandleShuffleAutocomplete)
+	RegisterAutocompleteHandler("play", HandlePlayAutocomplete)
+	RegisterAutocompleteHandler("playlist", HandlePlaylistAutocomplete)
+	RegisterAutocompleteHandler("247", HandleAlwaysOnAutocomplete)
 }
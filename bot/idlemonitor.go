@@ -1,108 +1,156 @@
 package bot
 
-// func StartIdleMonitor(guildID, textChannelID string, discord *discordgo.Session) {
-// 	CancelIdleMonitor(guildID)
-
-// 	ctx, cancel := context.WithCancel(context.Background())
-
-// 	GlobalQueue.Lock()
-// 	GlobalQueue.idleCancelFuncs[guildID] = cancel
-// 	GlobalQueue.Unlock()
-
-// 	go func() {
-// 		ticker := time.NewTicker(1 * time.Minute)
-// 		defer ticker.Stop()
-
-// 		for {
-// 			select {
-// 			case <-ctx.Done():
-// 				return
-// 			case <-ticker.C:
-// 				if vc, ok := GlobalQueue.GetVoiceConnection(guildID); ok && vc != nil {
-// 					channelID := vc.ChannelID
-// 					guild, err := discord.State.Guild(guildID)
-// 					if err != nil {
-// 						log.Printf("Failed to get guild state for %s: %v", guildID, err)
-// 						continue
-// 					}
-
-// 					nonBotCount := 0
-// 					for _, vs := range guild.VoiceStates {
-// 						if vs.ChannelID == channelID && vs.UserID != discord.State.User.ID {
-// 							member, err := discord.State.Member(guildID, vs.UserID)
-// 							if err == nil && !member.User.Bot {
-// 								nonBotCount++
-// 							}
-// 						}
-// 					}
-
-// 					if nonBotCount == 0 {
-// 						log.Printf("No users in VC in guild %s, leaving.", guildID)
-
-// 						if err := vc.Disconnect(); err != nil {
-// 							log.Printf("Error disconnecting: %v", err)
-// 						}
-
-// 						GlobalQueue.SetInVoiceChannel(guildID, false)
-// 						GlobalQueue.SetPlaying(guildID, false)
-
-// 						GlobalQueue.Lock()
-// 						delete(GlobalQueue.stopChans, guildID)
-// 						delete(GlobalQueue.idleCancelFuncs, guildID)
-// 						GlobalQueue.Unlock()
-
-// 						embed := &discordgo.MessageEmbed{
-// 							Title:       "👋 Voice Channel Empty",
-// 							Description: "Left the voice channel because no users were present.",
-// 							Color:       0x1DB954,
-// 						}
-// 						_, _ = discord.ChannelMessageSendEmbed(textChannelID, embed)
-// 						return
-// 					}
-// 				}
-
-// 				if GlobalQueue.IsPlaying(guildID) {
-// 					continue
-// 				}
-
-// 				last := GlobalQueue.GetLastActivity(guildID)
-// 				if time.Since(last) > 10*time.Minute {
-// 					log.Printf("Idle timeout reached for guild %s", guildID)
-
-// 					vc, ok := GlobalQueue.GetVoiceConnection(guildID)
-// 					if ok && vc != nil {
-// 						if err := vc.Disconnect(); err != nil {
-// 							log.Printf("Failed to disconnect from voice in guild %s: %v", guildID, err)
-// 						}
-// 					}
-
-// 					GlobalQueue.SetInVoiceChannel(guildID, false)
-// 					GlobalQueue.SetPlaying(guildID, false)
-
-// 					GlobalQueue.Lock()
-// 					delete(GlobalQueue.stopChans, guildID)
-// 					delete(GlobalQueue.idleCancelFuncs, guildID)
-// 					GlobalQueue.Unlock()
-
-// 					embed := &discordgo.MessageEmbed{
-// 						Title:       "💤 Idle Timeout",
-// 						Description: "Left the voice channel after 10 minutes of inactivity.",
-// 						Color:       0x1DB954,
-// 					}
-// 					_, _ = discord.ChannelMessageSendEmbed(textChannelID, embed)
-// 					return
-// 				}
-// 			}
-// 		}
-// 	}()
-// }
-
-// func CancelIdleMonitor(guildID string) {
-// 	GlobalQueue.Lock()
-// 	defer GlobalQueue.Unlock()
-
-// 	if cancel, ok := GlobalQueue.idleCancelFuncs[guildID]; ok {
-// 		cancel()
-// 		delete(GlobalQueue.idleCancelFuncs, guildID)
-// 	}
-// }
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type idleReason string
+
+const (
+	idleAlone      idleReason = "alone"
+	idleNoPlayback idleReason = "no_playback"
+)
+
+// Voice state changes drive the idle handling, so there's nothing to poll
+func VoiceStateUpdate(discord *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	if v.UserID == discord.State.User.ID {
+		handleBotVoiceState(discord, v)
+		return
+	}
+	if !GlobalQueue.IsInVoiceChannel(v.GuildID) {
+		return
+	}
+	UpdateIdleState(discord, v.GuildID)
+}
+
+// Decides whether the bot should pause, resume or start counting down to leaving. Called on every
+// voice state change in the guild and whenever playback starts or runs out. Guilds in 24/7 mode
+// still pause and resume but never leave.
+func UpdateIdleState(discord *discordgo.Session, guildID string) {
+	vc, ok := GlobalQueue.GetVoiceConnection(guildID)
+	if !ok || vc == nil || !GlobalQueue.IsInVoiceChannel(guildID) {
+		cancelIdleTimer(guildID)
+		return
+	}
+	settings := GlobalSettings.Get(guildID)
+
+	alone := len(voiceChannelListeners(discord, guildID, vc.ChannelID)) == 0
+	if alone {
+		if settings.AutoPause && GlobalQueue.autoPause(guildID) {
+			logInfof("Everyone left the voice channel in guild %s, pausing", guildID)
+		}
+	} else if GlobalQueue.autoResume(guildID) {
+		logInfof("Someone rejoined the voice channel in guild %s, resuming", guildID)
+	}
+
+	switch {
+	case settings.AlwaysOn:
+		cancelIdleTimer(guildID)
+	case alone:
+		scheduleIdleLeave(discord, guildID, idleAlone, settings.AloneTimeout)
+	case GlobalQueue.IsPlaying(guildID):
+		cancelIdleTimer(guildID)
+	default:
+		scheduleIdleLeave(discord, guildID, idleNoPlayback, settings.IdleTimeout)
+	}
+}
+
+// A timer that is already running for the same reason is left alone, so unrelated voice state
+// changes don't keep pushing it back. A timeout of 0 means never leave.
+func scheduleIdleLeave(discord *discordgo.Session, guildID string, reason idleReason, after time.Duration) {
+	if after <= 0 {
+		cancelIdleTimer(guildID)
+		return
+	}
+
+	GlobalQueue.Lock()
+	if cancel, ok := GlobalQueue.idleCancelFuncs[guildID]; ok {
+		if GlobalQueue.idleReasons[guildID] == reason {
+			GlobalQueue.Unlock()
+			return
+		}
+		cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	GlobalQueue.idleCancelFuncs[guildID] = cancel
+	GlobalQueue.idleReasons[guildID] = reason
+	GlobalQueue.Unlock()
+
+	go func() {
+		timer := time.NewTimer(after)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		// Checked under the lock so a cancel that races the timer still wins
+		GlobalQueue.Lock()
+		if ctx.Err() != nil {
+			GlobalQueue.Unlock()
+			return
+		}
+		delete(GlobalQueue.idleCancelFuncs, guildID)
+		delete(GlobalQueue.idleReasons, guildID)
+		GlobalQueue.Unlock()
+		cancel()
+
+		logInfof("Leaving voice in guild %s (%s for %s)", guildID, reason, after)
+		LeaveVoiceChannel(discord, guildID)
+
+		embed := &discordgo.MessageEmbed{
+			Title:       "💤 Idle Timeout",
+			Description: fmt.Sprintf("Left the voice channel after %s with nothing playing.", fmtLimitMinutes(after)),
+			Color:       0x1DB954,
+			Footer: &discordgo.MessageEmbedFooter{
+				Text: "Admins can change this with /settings idle_timeout.",
+			},
+		}
+		if reason == idleAlone {
+			embed.Title = "👋 Voice Channel Empty"
+			embed.Description = fmt.Sprintf("Left the voice channel after being alone for %s.", fmtLimitMinutes(after))
+			embed.Footer.Text = "Admins can change this with /settings alone_timeout."
+		}
+		sendGuildAnnouncement(discord, guildID, embed)
+	}()
+}
+
+func cancelIdleTimer(guildID string) {
+	GlobalQueue.Lock()
+	defer GlobalQueue.Unlock()
+
+	if cancel, ok := GlobalQueue.idleCancelFuncs[guildID]; ok {
+		cancel()
+		delete(GlobalQueue.idleCancelFuncs, guildID)
+		delete(GlobalQueue.idleReasons, guildID)
+	}
+}
+
+// Only pauses a track that is actually playing, and remembers that the bot paused it so it's
+// only resumed automatically if nobody paused it on purpose
+func (q *Queue) autoPause(guildID string) bool {
+	q.Lock()
+	defer q.Unlock()
+	if !q.playing[guildID] || q.paused[guildID] {
+		return false
+	}
+	q.paused[guildID] = true
+	q.autoPaused[guildID] = true
+	return true
+}
+
+func (q *Queue) autoResume(guildID string) bool {
+	q.Lock()
+	defer q.Unlock()
+	if !q.autoPaused[guildID] {
+		return false
+	}
+	delete(q.autoPaused, guildID)
+	q.paused[guildID] = false
+	return true
+}
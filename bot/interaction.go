@@ -1,7 +1,6 @@
 package bot
 
 import (
-	"log"
 	"strings"
 
 	"github.com/bwmarrin/discordgo"
@@ -18,9 +17,15 @@ func Interaction(discord *discordgo.Session, i *discordgo.InteractionCreate) {
 	case discordgo.InteractionApplicationCommand:
 		name := i.ApplicationCommandData().Name
 		if cmd, ok := SlashCommands[name]; ok {
+			if !requireCommandPermission(discord, i, name) {
+				return
+			}
+			if voiceControlCommands[name] && !requireSameVoiceChannel(discord, i) {
+				return
+			}
 			cmd.Handler(discord, i)
 		} else {
-			log.Println("Unknown slash command:", name)
+			logWarnf("Unknown slash command: %v", name)
 		}
 
 	case discordgo.InteractionMessageComponent:
@@ -31,14 +36,14 @@ func Interaction(discord *discordgo.Session, i *discordgo.InteractionCreate) {
 				return
 			}
 		}
-		log.Println("Unknown component interaction:", customID)
+		logWarnf("Unknown component interaction: %v", customID)
 
 	case discordgo.InteractionApplicationCommandAutocomplete:
 		name := i.ApplicationCommandData().Name
 		if handler, ok := AutocompleteHandlers[name]; ok {
 			handler(discord, i)
 		} else {
-			log.Println("Unknown autocomplete interaction for command:", name)
+			logWarnf("Unknown autocomplete interaction for command: %v", name)
 		}
 	}
 }
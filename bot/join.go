@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func HandleJoinCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guildID := i.GuildID
+	var channelID string
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "channel" {
+			channelID = option.ChannelValue(nil).ID
+		}
+	}
+	if channelID == "" {
+		channelID = findUserVoiceChannel(s, guildID, GetUserID(i))
+	}
+	if channelID == "" {
+		respondEphemeral(s, i, "❌ Pick a voice channel, or join one first.")
+		return
+	}
+
+	currentChannelID := currentVoiceChannel(guildID)
+	if currentChannelID == channelID {
+		respondEphemeral(s, i, fmt.Sprintf("🔊 I'm already in <#%s>.", channelID))
+		return
+	}
+	// Pulling the bot away from people who are listening is up to a DJ
+	if currentChannelID != "" && !isDJ(i) && len(voiceChannelListeners(s, guildID, currentChannelID)) > 0 {
+		respondEphemeral(s, i, fmt.Sprintf("🔒 Only a DJ can move me while people are listening in <#%s>.", currentChannelID))
+		return
+	}
+
+	// Joining the voice channel can take longer than Discord waits for a response
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		logWarnf("Failed to defer interaction: %v", err)
+		return
+	}
+
+	// Moving reuses the connection, so playback carries on in the new channel
+	if err := JoinVoiceChannel(s, guildID, channelID); err != nil {
+		logWarnf("Failed to join voice channel %s in guild %s: %v", channelID, guildID, err)
+		sendErrorFollowup(s, i, "Couldn't join that voice channel. Check that I'm allowed to connect.")
+		return
+	}
+
+	GlobalQueue.Lock()
+	if GlobalQueue.textChannels[guildID] == "" {
+		GlobalQueue.textChannels[guildID] = i.ChannelID
+	}
+	textChannelID := GlobalQueue.textChannels[guildID]
+	_, resuming := GlobalQueue.resumePoints[guildID]
+	queued := len(GlobalQueue.queues[textChannelID]) > 0
+	GlobalQueue.Unlock()
+
+	title, description := "🔊 Joined", fmt.Sprintf("I'm in <#%s>. Use /play to queue something.", channelID)
+	switch {
+	case currentChannelID != "":
+		title, description = "🔀 Moved", fmt.Sprintf("Moved from <#%s> to <#%s>.", currentChannelID, channelID)
+	case resuming || queued:
+		description = fmt.Sprintf("I'm in <#%s>, picking the queue back up.", channelID)
+		go StartPlaybackIfNotActive(s, guildID, textChannelID)
+	default:
+		continueAlwaysOn(s, guildID)
+	}
+	sendEmbedFollowup(s, i, &discordgo.MessageEmbed{
+		Title:       title,
+		Description: description,
+		Color:       0x1DB954,
+	})
+}
+
+// Unlike /stop the queue is kept, and the track that was playing picks up where it left off after /join or /play
+func HandleLeaveCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	guildID := i.GuildID
+	vc, ok := GlobalQueue.GetVoiceConnection(guildID)
+	if !GlobalQueue.IsInVoiceChannel(guildID) || !ok || vc == nil {
+		respondEphemeral(s, i, "🔇 I'm not in a voice channel.")
+		return
+	}
+	vc.RLock()
+	channelID := vc.ChannelID
+	vc.RUnlock()
+
+	cancelIdleTimer(guildID)
+	GlobalQueue.suspendPlayback(guildID)
+	// Marked first so the voice state update from disconnecting isn't mistaken for being kicked
+	GlobalQueue.SetInVoiceChannel(guildID, false)
+	if err := vc.Disconnect(); err != nil {
+		logWarnf("Failed to disconnect voice connection for guild %s: %v", guildID, err)
+	}
+	DisableNowPlayingPanel(s, guildID)
+
+	description := fmt.Sprintf("Left <#%s>.", channelID)
+	if len(GlobalQueue.Get(GlobalQueue.GetTextChannel(guildID))) > 0 || GlobalQueue.IsPlaying(guildID) {
+		description += " The queue is kept, use /join or /play to carry on."
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{Title: "👋 Left Voice", Description: description, Color: 0x1DB954},
+			},
+		},
+	})
+	if err != nil {
+		logWarnf("Failed to respond to leave command: %v", err)
+	}
+}
+
+// Stops the running track without moving on, it resumes from the same spot the next time playback
+// starts. Returns false if nothing was playing.
+func (q *Queue) suspendPlayback(guildID string) bool {
+	q.Lock()
+	stop, ok := q.stopChans[guildID]
+	if !ok {
+		q.Unlock()
+		return false
+	}
+	q.suspended[guildID] = true
+	q.Unlock()
+
+	select {
+	case stop <- true:
+	default:
+	}
+	return true
+}
+
+func (q *Queue) takeSuspended(guildID string) bool {
+	q.Lock()
+	defer q.Unlock()
+	suspended := q.suspended[guildID]
+	delete(q.suspended, guildID)
+	return suspended
+}
+
+// The voice channel the bot is in right now, or "" if it isn't in one
+func currentVoiceChannel(guildID string) string {
+	vc, ok := GlobalQueue.GetVoiceConnection(guildID)
+	if !ok || vc == nil || !GlobalQueue.IsInVoiceChannel(guildID) {
+		return ""
+	}
+	vc.RLock()
+	defer vc.RUnlock()
+	return vc.ChannelID
+}
+
+// Records the voice channel the bot means to be in and returns the previous one
+func (q *Queue) setVoiceChannel(guildID, channelID string) string {
+	q.Lock()
+	defer q.Unlock()
+	previous := q.voiceChannels[guildID]
+	q.voiceChannels[guildID] = channelID
+	return previous
+}
+
+// Picks up the connection discordgo is using after the bot was dragged to another channel, in case it
+// had to replace the one playback was started on
+func syncVoiceConnection(discord *discordgo.Session, guildID string) {
+	discord.RLock()
+	vc := discord.VoiceConnections[guildID]
+	discord.RUnlock()
+	if vc != nil {
+		GlobalQueue.SaveVoiceConnection(guildID, vc)
+	}
+}
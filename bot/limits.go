@@ -0,0 +1,120 @@
+package bot
+
+import "fmt"
+
+type QueueLimitError struct {
+	Message string
+}
+
+func (e *QueueLimitError) Error() string {
+	return e.Message
+}
+
+// Tracks that are still downloading count towards the limits too, otherwise a burst of requests could
+// slip past them. Must be called with the queue locked.
+func (q *Queue) checkLimitsLocked(guildID, channelID, userID string, video VideoInfo) error {
+	settings := GlobalSettings.Get(guildID)
+
+	if exceedsMaxLength(video, settings.MaxTrackLength) {
+		return &QueueLimitError{Message: fmt.Sprintf("**%s** is longer than this server's limit of %s.", video.Title, fmtLimitMinutes(settings.MaxTrackLength))}
+	}
+
+	queued := len(q.queues[channelID])
+	userQueued := 0
+	for _, item := range q.queues[channelID] {
+		if item.RequestedBy == userID {
+			userQueued++
+		}
+	}
+	for _, item := range q.pending[channelID] {
+		queued++
+		if item.RequestedBy == userID {
+			userQueued++
+		}
+	}
+
+	if settings.MaxQueueLength > 0 && queued >= settings.MaxQueueLength {
+		return &QueueLimitError{Message: fmt.Sprintf("The queue is full (%d tracks max).", settings.MaxQueueLength)}
+	}
+	if settings.MaxTracksPerUser > 0 && userQueued >= settings.MaxTracksPerUser {
+		return &QueueLimitError{Message: fmt.Sprintf("You already have %d tracks queued, which is this server's limit per person.", userQueued)}
+	}
+	return nil
+}
+
+// A snapshot of how much more the queue takes, for checking a batch of tracks before the slow lookups.
+// Add still checks every track.
+type queueRoom struct {
+	remaining  int // -1 means no limit
+	perUser    int // 0 means no limit
+	userQueued map[string]int
+}
+
+func (q *Queue) room(guildID, channelID string) *queueRoom {
+	settings := GlobalSettings.Get(guildID)
+	q.Lock()
+	defer q.Unlock()
+
+	room := &queueRoom{remaining: -1, perUser: settings.MaxTracksPerUser, userQueued: make(map[string]int)}
+	queued := 0
+	for _, items := range [][]VideoInfo{q.queues[channelID], q.pending[channelID]} {
+		for _, item := range items {
+			queued++
+			room.userQueued[item.RequestedBy]++
+		}
+	}
+	if settings.MaxQueueLength > 0 {
+		room.remaining = max(0, settings.MaxQueueLength-queued)
+	}
+	return room
+}
+
+// Reserves a spot for one of userID's tracks, returns false if there isn't one
+func (r *queueRoom) take(userID string) bool {
+	if r.remaining == 0 || (r.perUser > 0 && r.userQueued[userID] >= r.perUser) {
+		return false
+	}
+	if r.remaining > 0 {
+		r.remaining--
+	}
+	r.userQueued[userID]++
+	return true
+}
+
+// Interleaves the queue so each requester gets a turn in the order they first queued something,
+// keeping each person's own tracks in the order they asked for them
+func fairOrder(queue []VideoInfo, requesters map[string]struct{}) []VideoInfo {
+	var order []string
+	byUser := make(map[string][]VideoInfo)
+	for _, video := range queue {
+		if _, ok := requesters[video.RequestedBy]; !ok {
+			continue
+		}
+		if _, seen := byUser[video.RequestedBy]; !seen {
+			order = append(order, video.RequestedBy)
+		}
+		byUser[video.RequestedBy] = append(byUser[video.RequestedBy], video)
+	}
+
+	ordered := make([]VideoInfo, 0, len(queue))
+	for round := 0; len(ordered) < len(queue); round++ {
+		added := false
+		for _, userID := range order {
+			if round < len(byUser[userID]) {
+				ordered = append(ordered, byUser[userID][round])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+
+	// Anything from a requester we have no record of keeps its place at the back
+	for _, video := range queue {
+		if _, ok := requesters[video.RequestedBy]; !ok {
+			ordered = append(ordered, video)
+		}
+	}
+	return ordered
+}
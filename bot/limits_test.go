@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFairOrder(t *testing.T) {
+	track := func(title, user string) VideoInfo {
+		return VideoInfo{Title: title, RequestedBy: user}
+	}
+	requesters := func(users ...string) map[string]struct{} {
+		set := make(map[string]struct{})
+		for _, user := range users {
+			set[user] = struct{}{}
+		}
+		return set
+	}
+
+	tests := []struct {
+		name       string
+		queue      []VideoInfo
+		requesters map[string]struct{}
+		want       []string
+	}{
+		{
+			name:       "empty",
+			requesters: requesters(),
+			want:       nil,
+		},
+		{
+			name:       "single requester keeps order",
+			queue:      []VideoInfo{track("a1", "a"), track("a2", "a"), track("a3", "a")},
+			requesters: requesters("a"),
+			want:       []string{"a1", "a2", "a3"},
+		},
+		{
+			name:       "takes turns in order of first request",
+			queue:      []VideoInfo{track("a1", "a"), track("a2", "a"), track("a3", "a"), track("b1", "b"), track("c1", "c"), track("b2", "b")},
+			requesters: requesters("a", "b", "c"),
+			want:       []string{"a1", "b1", "c1", "a2", "b2", "a3"},
+		},
+		{
+			name:       "unknown requesters go to the back",
+			queue:      []VideoInfo{track("x1", "x"), track("a1", "a"), track("a2", "a"), track("b1", "b")},
+			requesters: requesters("a", "b"),
+			want:       []string{"a1", "b1", "a2", "x1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, video := range fairOrder(tt.queue, tt.requesters) {
+				got = append(got, video.Title)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("fairOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
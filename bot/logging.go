@@ -0,0 +1,22 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Printf-style logging at a level. Lines still go through the standard logger, with the level in front,
+// and anything below log_level is dropped.
+func logDebugf(format string, args ...any) { logf(slog.LevelDebug, format, args...) }
+func logInfof(format string, args ...any)  { logf(slog.LevelInfo, format, args...) }
+func logWarnf(format string, args ...any)  { logf(slog.LevelWarn, format, args...) }
+func logErrorf(format string, args ...any) { logf(slog.LevelError, format, args...) }
+
+func logf(level slog.Level, format string, args ...any) {
+	ctx := context.Background()
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+	slog.Default().Log(ctx, level, fmt.Sprintf(format, args...))
+}
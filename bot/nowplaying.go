@@ -1,17 +1,99 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-func SendNowPlayingEmbed(s *discordgo.Session, channelID string, video VideoInfo) {
+const (
+	// Edits to the same message share a rate limit bucket, so don't refresh the progress bar any faster than this
+	nowPlayingRefreshInterval = 15 * time.Second
+	progressBarSegments       = 16
+)
+
+const (
+	defaultVolume = 100
+	minVolume     = 0
+	maxVolume     = 200
+	volumeStep    = 10
+)
+
+// Posts the now playing panel for a new track and disables the buttons on the previous one
+func SendNowPlayingEmbed(s *discordgo.Session, guildID, channelID string, video VideoInfo) {
+	DisableNowPlayingPanel(s, guildID)
+
+	msg, err := s.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{buildNowPlayingEmbed(guildID, channelID, video)},
+		Components: buildNowPlayingControls(guildID, channelID, false),
+	})
+	if err != nil {
+		logWarnf("Failed to send now playing panel in guild %s: %v", guildID, err)
+		return
+	}
+	GlobalQueue.SetNowPlayingPanel(guildID, msg)
+
+	go refreshNowPlayingPanel(s, guildID, channelID, msg.ID, video)
+}
+
+// Keeps the progress bar moving until the panel is replaced, disabled or deleted
+func refreshNowPlayingPanel(s *discordgo.Session, guildID, channelID, messageID string, video VideoInfo) {
+	ticker := time.NewTicker(nowPlayingRefreshInterval)
+	defer ticker.Stop()
+
+	var lastEmbed string
+	for range ticker.C {
+		panel, ok := GlobalQueue.GetNowPlayingPanel(guildID)
+		if !ok || panel.ID != messageID {
+			return
+		}
+
+		embed := buildNowPlayingEmbed(guildID, channelID, video)
+		// Nothing moves while paused, so skip the request
+		key := embed.Title
+		for _, field := range embed.Fields {
+			key += field.Value
+		}
+		if key == lastEmbed {
+			continue
+		}
+		lastEmbed = key
+
+		// Only the embed is sent so a late refresh can't re-enable buttons on a panel that was just disabled
+		_, err := s.ChannelMessageEditEmbed(channelID, messageID, embed)
+		if err != nil {
+			var restErr *discordgo.RESTError
+			if errors.As(err, &restErr) && restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeUnknownMessage {
+				logInfof("Now playing panel in guild %s was deleted, no longer refreshing it", guildID)
+				clearNowPlayingPanelIfCurrent(guildID, messageID)
+				return
+			}
+			logWarnf("Failed to refresh now playing panel in guild %s: %v", guildID, err)
+		}
+	}
+}
+
+func clearNowPlayingPanelIfCurrent(guildID, messageID string) {
+	GlobalQueue.Lock()
+	defer GlobalQueue.Unlock()
+	if panel, ok := GlobalQueue.nowPlayingPanels[guildID]; ok && panel.ID == messageID {
+		delete(GlobalQueue.nowPlayingPanels, guildID)
+	}
+}
+
+func buildNowPlayingEmbed(guildID, channelID string, video VideoInfo) *discordgo.MessageEmbed {
 	duration := time.Duration(video.Duration) * time.Second
 
-	embed := &discordgo.MessageEmbed{
-		Title:       "🎶 Now Playing",
+	title := "🎶 Now Playing"
+	if GlobalQueue.IsPaused(guildID) {
+		title = "⏸️ Paused"
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       title,
 		Description: fmt.Sprintf("[%s](%s)", video.Title, video.WebURL),
 		Color:       0x1DB954,
 		Fields: []*discordgo.MessageEmbedField{
@@ -25,13 +107,111 @@ func SendNowPlayingEmbed(s *discordgo.Session, channelID string, video VideoInfo
 				Value:  fmtDuration(duration),
 				Inline: true,
 			},
+			{
+				Name:   "Modes",
+				Value:  fmtPlaybackModes(guildID, channelID),
+				Inline: true,
+			},
+			{
+				Name:  "Progress",
+				Value: fmtProgress(GlobalQueue.GetPosition(guildID), duration),
+			},
+			{
+				Name:  "Up Next",
+				Value: fmtUpNext(channelID),
+			},
 		},
 		Footer: &discordgo.MessageEmbedFooter{
-			Text: "Try /shuffle, /skip, /stop & more. Use /help to see all commands",
+			Text: "Use the buttons below to control playback, or /help to see all commands",
 		},
 	}
+}
+
+func fmtProgress(elapsed, total time.Duration) string {
+	if total <= 0 {
+		return fmt.Sprintf("`%s` elapsed", fmtDuration(elapsed))
+	}
+	elapsed = min(elapsed, total)
+
+	marker := int(float64(progressBarSegments) * elapsed.Seconds() / total.Seconds())
+	marker = min(marker, progressBarSegments-1)
+	bar := strings.Repeat("▬", marker) + "🔘" + strings.Repeat("▬", progressBarSegments-marker-1)
+
+	return fmt.Sprintf("%s\n`%s / %s` • %s left", bar, fmtDuration(elapsed), fmtDuration(total), fmtDuration(total-elapsed))
+}
+
+func fmtUpNext(channelID string) string {
+	queue := GlobalQueue.Get(channelID)
+	if len(queue) == 0 {
+		return "Nothing queued"
+	}
+	if GlobalQueue.IsShuffleEnabled(channelID) {
+		return fmt.Sprintf("A random pick from %d queued tracks", len(queue))
+	}
+	next := queue[0]
+	return fmt.Sprintf("[%s](%s) • requested by <@%s>", next.Title, next.WebURL, next.RequestedBy)
+}
+
+func fmtPlaybackModes(guildID, channelID string) string {
+	shuffle := "off"
+	if GlobalQueue.IsShuffleEnabled(channelID) {
+		shuffle = "on"
+	}
+	loop := "off"
+	if GlobalQueue.IsLoopEnabled(guildID) {
+		loop = "on"
+	}
+	return fmt.Sprintf("🔊 %d%% • 🔀 %s • 🔁 %s", GlobalQueue.GetVolume(guildID), shuffle, loop)
+}
+
+func buildNowPlayingControls(guildID, channelID string, disabled bool) []discordgo.MessageComponent {
+	pauseLabel, pauseEmoji := "Pause", "⏸️"
+	if GlobalQueue.IsPaused(guildID) {
+		pauseLabel, pauseEmoji = "Resume", "▶️"
+	}
+
+	shuffleStyle := discordgo.SecondaryButton
+	if GlobalQueue.IsShuffleEnabled(channelID) {
+		shuffleStyle = discordgo.SuccessButton
+	}
+	loopStyle := discordgo.SecondaryButton
+	if GlobalQueue.IsLoopEnabled(guildID) {
+		loopStyle = discordgo.SuccessButton
+	}
+
+	volume := GlobalQueue.GetVolume(guildID)
 
-	s.ChannelMessageSendEmbed(channelID, embed)
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: pauseLabel, Emoji: &discordgo.ComponentEmoji{Name: pauseEmoji}, Style: discordgo.PrimaryButton, CustomID: "np_pause", Disabled: disabled},
+			discordgo.Button{Label: "Skip", Emoji: &discordgo.ComponentEmoji{Name: "⏭️"}, Style: discordgo.SecondaryButton, CustomID: "np_skip", Disabled: disabled},
+			discordgo.Button{Label: "Stop", Emoji: &discordgo.ComponentEmoji{Name: "⏹️"}, Style: discordgo.DangerButton, CustomID: "np_stop", Disabled: disabled},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "Shuffle", Emoji: &discordgo.ComponentEmoji{Name: "🔀"}, Style: shuffleStyle, CustomID: "np_shuffle", Disabled: disabled},
+			discordgo.Button{Label: "Loop", Emoji: &discordgo.ComponentEmoji{Name: "🔁"}, Style: loopStyle, CustomID: "np_loop", Disabled: disabled},
+			discordgo.Button{Emoji: &discordgo.ComponentEmoji{Name: "🔉"}, Style: discordgo.SecondaryButton, CustomID: "np_volume_down", Disabled: disabled || volume <= minVolume},
+			discordgo.Button{Emoji: &discordgo.ComponentEmoji{Name: "🔊"}, Style: discordgo.SecondaryButton, CustomID: "np_volume_up", Disabled: disabled || volume >= maxVolume},
+		}},
+	}
+}
+
+func DisableNowPlayingPanel(s *discordgo.Session, guildID string) {
+	msg, ok := GlobalQueue.GetNowPlayingPanel(guildID)
+	if !ok {
+		return
+	}
+	GlobalQueue.SetNowPlayingPanel(guildID, nil)
+
+	components := buildNowPlayingControls(guildID, msg.ChannelID, true)
+	_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         msg.ID,
+		Channel:    msg.ChannelID,
+		Components: &components,
+	})
+	if err != nil {
+		logWarnf("Failed to disable now playing panel in guild %s: %v", guildID, err)
+	}
 }
 
 func fmtDuration(d time.Duration) string {
@@ -0,0 +1,216 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type PermissionLevel string
+
+const (
+	PermissionEveryone PermissionLevel = "everyone"
+	PermissionDJ       PermissionLevel = "dj"
+	PermissionAdmin    PermissionLevel = "admin"
+)
+
+// Destructive commands need a DJ out of the box, servers can loosen or tighten these with /permissions.
+// The admin ones change how the bot runs for the whole server and always stay admin-only.
+var defaultCommandPermissions = map[string]PermissionLevel{
+	"clear":       PermissionDJ,
+	"stop":        PermissionDJ,
+	"leave":       PermissionDJ,
+	"settings":    PermissionAdmin,
+	"permissions": PermissionAdmin,
+	"247":         PermissionAdmin,
+}
+
+func isAdmin(i *discordgo.InteractionCreate) bool {
+	if i.Member == nil {
+		return false
+	}
+	return i.Member.Permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageGuild) != 0
+}
+
+// DJs can control playback for everyone, e.g. skipping a track without a vote
+func isDJ(i *discordgo.InteractionCreate) bool {
+	if i.Member == nil {
+		return false
+	}
+	if isAdmin(i) || i.Member.Permissions&discordgo.PermissionManageChannels != 0 {
+		return true
+	}
+
+	djRoleID := GlobalSettings.Get(i.GuildID).DJRoleID
+	if djRoleID == "" {
+		return false
+	}
+	for _, roleID := range i.Member.Roles {
+		if roleID == djRoleID {
+			return true
+		}
+	}
+	return false
+}
+
+func isAdminCommand(commandName string) bool {
+	return defaultCommandPermissions[commandName] == PermissionAdmin
+}
+
+func commandPermissionLevel(guildID, commandName string) PermissionLevel {
+	// Overrides saved before admin commands were locked are ignored
+	if isAdminCommand(commandName) {
+		return PermissionAdmin
+	}
+	if level, ok := GlobalSettings.Get(guildID).CommandPermissions[commandName]; ok {
+		return level
+	}
+	if level, ok := defaultCommandPermissions[commandName]; ok {
+		return level
+	}
+	return PermissionEveryone
+}
+
+func hasPermissionLevel(i *discordgo.InteractionCreate, level PermissionLevel) bool {
+	switch level {
+	case PermissionAdmin:
+		return isAdmin(i)
+	case PermissionDJ:
+		return isDJ(i)
+	default:
+		return true
+	}
+}
+
+// Responds with an ephemeral error and returns false if the user isn't allowed to run the command
+func requireCommandPermission(s *discordgo.Session, i *discordgo.InteractionCreate, commandName string) bool {
+	level := commandPermissionLevel(i.GuildID, commandName)
+	if hasPermissionLevel(i, level) {
+		return true
+	}
+
+	message := fmt.Sprintf("🔒 `/%s` can only be used by server admins.", commandName)
+	if level == PermissionDJ {
+		message = fmt.Sprintf("🔒 `/%s` can only be used by DJs.", commandName)
+		if djRoleID := GlobalSettings.Get(i.GuildID).DJRoleID; djRoleID != "" {
+			message = fmt.Sprintf("🔒 `/%s` can only be used by members with the <@&%s> role.", commandName, djRoleID)
+		}
+	}
+	respondEphemeral(s, i, message)
+	return false
+}
+
+func HandlePermissionsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		return
+	}
+	sub := options[0]
+
+	switch sub.Name {
+	case "dj_role":
+		var roleID string
+		for _, option := range sub.Options {
+			if option.Name == "role" {
+				roleID = option.RoleValue(nil, "").ID
+			}
+		}
+		_, err := GlobalSettings.Update(i.GuildID, func(gs *GuildSettings) {
+			gs.DJRoleID = roleID
+		})
+		if err != nil {
+			logErrorf("Failed to update DJ role: %v", err)
+			respondEphemeral(s, i, "❌ Couldn't save the DJ role, please try again.")
+			return
+		}
+
+		description := "The DJ role has been cleared. Only members who can manage the server or its channels count as DJs."
+		if roleID != "" {
+			description = fmt.Sprintf("Members with <@&%s> are now DJs.", roleID)
+		}
+		respondPermissionsEmbed(s, i, "🎧 DJ Role Updated", description)
+
+	case "command":
+		var commandName string
+		var level PermissionLevel
+		for _, option := range sub.Options {
+			switch option.Name {
+			case "name":
+				commandName = option.StringValue()
+			case "level":
+				level = PermissionLevel(option.StringValue())
+			}
+		}
+
+		if _, ok := SlashCommands[commandName]; !ok {
+			respondEphemeral(s, i, fmt.Sprintf("❌ Unknown command `/%s`.", commandName))
+			return
+		}
+		if isAdminCommand(commandName) && level != PermissionAdmin {
+			respondEphemeral(s, i, fmt.Sprintf("❌ `/%s` always requires an admin.", commandName))
+			return
+		}
+
+		_, err := GlobalSettings.Update(i.GuildID, func(gs *GuildSettings) {
+			gs.CommandPermissions[commandName] = level
+		})
+		if err != nil {
+			logErrorf("Failed to update permission for /%s: %v", commandName, err)
+			respondEphemeral(s, i, "❌ Couldn't save the permission, please try again.")
+			return
+		}
+		respondPermissionsEmbed(s, i, "🔐 Command Permission Updated", fmt.Sprintf("`/%s` now requires **%s**.", commandName, level))
+
+	case "show":
+		respondPermissionsEmbed(s, i, "🔐 Command Permissions", describePermissions(i.GuildID))
+	}
+}
+
+func describePermissions(guildID string) string {
+	var builder strings.Builder
+
+	djRole := "not set"
+	if roleID := GlobalSettings.Get(guildID).DJRoleID; roleID != "" {
+		djRole = fmt.Sprintf("<@&%s>", roleID)
+	}
+	fmt.Fprintf(&builder, "**DJ role:** %s\n\n", djRole)
+
+	var names []string
+	for name := range SlashCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&builder, "`/%s` — %s\n", name, commandPermissionLevel(guildID, name))
+	}
+	return builder.String()
+}
+
+func respondPermissionsEmbed(s *discordgo.Session, i *discordgo.InteractionCreate, title, description string) {
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       title,
+					Description: description,
+					Color:       0x1DB954,
+					Footer: &discordgo.MessageEmbedFooter{
+						Text: "Admins can always use every command. DJs also include anyone who can manage channels.",
+					},
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+func permissionLevelChoices() []*discordgo.ApplicationCommandOptionChoice {
+	return []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "Everyone", Value: string(PermissionEveryone)},
+		{Name: "DJ", Value: string(PermissionDJ)},
+		{Name: "Admin", Value: string(PermissionAdmin)},
+	}
+}
@@ -1,38 +1,79 @@
 package bot
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+const (
+	searchResultCount      = 50
+	searchPageSize         = 25
+	searchSelectionTimeout = 5 * time.Minute
+)
+
+// Search results belong to the /play interaction that produced them, so a second search by the
+// same user can't change what the buttons on an older results message queue
+type searchSession struct {
+	ID        string
+	OwnerID   string
+	Query     string
+	Videos    []VideoInfo
+	Page      int
+	CreatedAt time.Time
+}
+
 var (
-	mu                  sync.Mutex
-	searchResultsByUser = make(map[string][]VideoInfo)
+	mu             sync.Mutex
+	searchSessions = make(map[string]*searchSession)
 )
 
-func GetSearchResults(userID string) ([]VideoInfo, bool) {
+func GetSearchSession(sessionID string) (*searchSession, bool) {
 	mu.Lock()
 	defer mu.Unlock()
-	videos, ok := searchResultsByUser[userID]
-	return videos, ok
+	session, ok := searchSessions[sessionID]
+	if !ok || time.Since(session.CreatedAt) > searchSelectionTimeout {
+		return nil, false
+	}
+	return session, true
 }
 
-func SetSearchResults(userID string, videos []VideoInfo) {
+func SetSearchSession(session *searchSession) {
 	mu.Lock()
 	defer mu.Unlock()
-	searchResultsByUser[userID] = videos
+
+	// Evict anything the expiry timer missed, e.g. if disabling the message failed
+	for id, existing := range searchSessions {
+		if time.Since(existing.CreatedAt) > searchSelectionTimeout {
+			delete(searchSessions, id)
+		}
+	}
+	searchSessions[session.ID] = session
 }
 
-func DeleteSearchResults(userID string) {
+func DeleteSearchSession(sessionID string) {
 	mu.Lock()
 	defer mu.Unlock()
-	delete(searchResultsByUser, userID)
+	delete(searchSessions, sessionID)
+}
+
+// Pulls the session ID out of custom IDs shaped like "select_video:<session>" or "search_page:<session>:<page>"
+func searchSessionFromCustomID(customID string) (sessionID string, page int) {
+	parts := strings.Split(customID, ":")
+	if len(parts) > 1 {
+		sessionID = parts[1]
+	}
+	if len(parts) > 2 {
+		page, _ = strconv.Atoi(parts[2])
+	}
+	return sessionID, page
 }
 
 func HandlePlayCommand(discord *discordgo.Session, i *discordgo.InteractionCreate) {
@@ -42,21 +83,34 @@ func HandlePlayCommand(discord *discordgo.Session, i *discordgo.InteractionCreat
 	if err := discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 	}); err != nil {
-		log.Printf("Failed to defer interaction: %v", err)
+		logWarnf("Failed to defer interaction: %v", err)
 		return
 	}
 
 	go func() {
+		if provider, ok := findMetadataProvider(query); ok {
+			handleMusicServiceLink(discord, i, userID, provider, query)
+			return
+		}
+
 		if isYouTubeLink(query) {
 			sanitizedURL := sanitizeYouTubeURL(query)
 			video, err := YoutubeGetInfo(sanitizedURL)
 			if err != nil {
-				log.Printf("Failed to get video info for %s: %v", sanitizedURL, err)
+				logWarnf("Failed to get video info for %s: %v", sanitizedURL, err)
 				sendErrorFollowup(discord, i, "Failed to get video info. Please make sure the link is valid.")
 				return
 			}
 
-			GlobalQueue.Add(discord, i.Interaction, i.GuildID, i.ChannelID, userID, video)
+			if err := GlobalQueue.Add(discord, i.Interaction, i.GuildID, i.ChannelID, userID, video); err != nil {
+				var dup *DuplicateTrackError
+				if errors.As(err, &dup) && dup.Policy == DuplicateWarn {
+					sendDuplicatePrompt(discord, i, userID, []*DuplicateTrackError{dup})
+					return
+				}
+				sendErrorFollowup(discord, i, err.Error())
+				return
+			}
 
 			duration := time.Duration(video.Duration) * time.Second
 			embed := &discordgo.MessageEmbed{
@@ -68,7 +122,7 @@ func HandlePlayCommand(discord *discordgo.Session, i *discordgo.InteractionCreat
 					{Name: "Duration", Value: fmtDuration(duration), Inline: true},
 				},
 				Footer: &discordgo.MessageEmbedFooter{
-					Text: "Use /queue to view the current queue.",
+					Text: "Use /queue show to view the current queue.",
 				},
 			}
 
@@ -76,38 +130,239 @@ func HandlePlayCommand(discord *discordgo.Session, i *discordgo.InteractionCreat
 			return
 		}
 
-		searchResults := YoutubeSearch(query)
-		SetSearchResults(userID, searchResults.Videos)
+		searchResults, err := YoutubeSearch(query, searchResultCount)
+		if err != nil {
+			logWarnf("YouTube search failed for %q: %v", query, err)
+			sendErrorFollowup(discord, i, "Search failed. Please try again in a moment.")
+			return
+		}
+
+		videos := RankSearchResults(query, searchResults.Videos, GlobalSettings.Get(i.GuildID).MaxTrackLength)
+		if len(videos) == 0 {
+			sendErrorFollowup(discord, i, "No results found. Try a different search, or check this server's max track length with /settings.")
+			return
+		}
 
-		var buttons []discordgo.MessageComponent
-		for idx := range searchResults.Videos {
-			buttons = append(buttons, discordgo.Button{
-				Label:    fmt.Sprintf("%d", idx+1),
-				Style:    discordgo.PrimaryButton,
-				CustomID: fmt.Sprintf("select_video_%d", idx+1),
-			})
+		session := &searchSession{
+			ID:        i.Interaction.ID,
+			OwnerID:   userID,
+			Query:     query,
+			Videos:    videos,
+			CreatedAt: time.Now(),
 		}
+		SetSearchSession(session)
 
-		components := []discordgo.MessageComponent{
-			discordgo.ActionsRow{Components: buttons},
+		embed, components := buildSearchResultsMessage(session, 0, false)
+		msg := sendEmbedFollowupWithComponents(discord, i, embed, components)
+		if msg == nil {
+			return
 		}
 
-		var builder strings.Builder
-		for i, v := range searchResults.Videos {
-			mins := int(v.Duration) / 60
-			secs := int(v.Duration) % 60
-			fmt.Fprintf(&builder, "**%d.** %s (%02d:%02d)\n", i+1, v.Title, mins, secs)
+		time.AfterFunc(searchSelectionTimeout, func() {
+			expireSearchSession(discord, i.Interaction, msg.ID, session)
+		})
+	}()
+}
+
+func buildSearchResultsMessage(session *searchSession, page int, disabled bool) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	pageCount := (len(session.Videos) + searchPageSize - 1) / searchPageSize
+	start := page * searchPageSize
+	end := min(start+searchPageSize, len(session.Videos))
+
+	var builder strings.Builder
+	var options []discordgo.SelectMenuOption
+	for idx := start; idx < end; idx++ {
+		v := session.Videos[idx]
+		duration := fmtDuration(time.Duration(v.Duration) * time.Second)
+		fmt.Fprintf(&builder, "**%d.** %s (%s)\n", idx+1, v.Title, duration)
+
+		description := duration
+		if uploader := v.uploaderName(); uploader != "" {
+			description = uploader + " • " + duration
 		}
+		options = append(options, discordgo.SelectMenuOption{
+			Label:       truncateRunes(fmt.Sprintf("%d. %s", idx+1, v.Title), 100),
+			Value:       strconv.Itoa(idx),
+			Description: truncateRunes(description, 100),
+		})
+	}
+
+	minValues := 1
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:    discordgo.StringSelectMenu,
+				CustomID:    "select_video:" + session.ID,
+				Placeholder: "Choose one or more songs to queue",
+				MinValues:   &minValues,
+				MaxValues:   len(options),
+				Options:     options,
+				Disabled:    disabled,
+			},
+		}},
+	}
+
+	if pageCount > 1 {
+		components = append(components, discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "◀ Previous",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("search_page:%s:%d", session.ID, page-1),
+				Disabled: disabled || page == 0,
+			},
+			discordgo.Button{
+				Label:    "Next ▶",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("search_page:%s:%d", session.ID, page+1),
+				Disabled: disabled || page >= pageCount-1,
+			},
+		}})
+	}
+
+	footer := fmt.Sprintf("Page %d of %d • Pick songs from the menu below, it expires in %d minutes", page+1, pageCount, int(searchSelectionTimeout.Minutes()))
+	if disabled {
+		footer = "This search has expired. Use /play to search again"
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "🔍 Search Results",
+		Description: builder.String(),
+		Color:       0x1DB954,
+		Footer:      &discordgo.MessageEmbedFooter{Text: footer},
+	}
+	return embed, components
+}
+
+func expireSearchSession(discord *discordgo.Session, interaction *discordgo.Interaction, messageID string, session *searchSession) {
+	mu.Lock()
+	_, pending := searchSessions[session.ID]
+	delete(searchSessions, session.ID)
+	page := session.Page
+	mu.Unlock()
+
+	// Already picked from, and the selection handler disabled the menu itself
+	if !pending {
+		return
+	}
+
+	embed, components := buildSearchResultsMessage(session, page, true)
+	_, err := discord.FollowupMessageEdit(interaction, messageID, &discordgo.WebhookEdit{
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &components,
+	})
+	if err != nil {
+		logWarnf("Failed to disable expired search results: %v", err)
+	}
+}
+
+func truncateRunes(s string, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) <= maxRunes {
+		return s
+	}
+	return string(runes[:maxRunes-1]) + "…"
+}
+
+func handleMusicServiceLink(discord *discordgo.Session, i *discordgo.InteractionCreate, userID string, provider MetadataProvider, link string) {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	resolved, failed, err := ResolveLink(ctx, provider, link)
+	if err != nil {
+		logWarnf("Failed to resolve %s link %s: %v", provider.Name(), link, err)
+		sendErrorFollowup(discord, i, fmt.Sprintf("Couldn't read that %s link. Please make sure it's public and valid.", provider.Name()))
+		return
+	}
+	if len(resolved) == 0 {
+		sendErrorFollowup(discord, i, fmt.Sprintf("Couldn't find any of the tracks from that %s link on YouTube.", provider.Name()))
+		return
+	}
+
+	var accepted []ResolvedTrack
+	var duplicates []*DuplicateTrackError
+	var lastErr error
+	for _, track := range resolved {
+		if err := GlobalQueue.Add(discord, i.Interaction, i.GuildID, i.ChannelID, userID, track.Video); err != nil {
+			var dup *DuplicateTrackError
+			if errors.As(err, &dup) && dup.Policy == DuplicateWarn {
+				duplicates = append(duplicates, dup)
+				continue
+			}
+			failed = append(failed, track.Source)
+			lastErr = err
+			continue
+		}
+		accepted = append(accepted, track)
+	}
+	resolved = accepted
+	defer sendDuplicatePrompt(discord, i, userID, duplicates)
+	if len(resolved) == 0 {
+		if lastErr != nil {
+			sendErrorFollowup(discord, i, lastErr.Error())
+		}
+		return
+	}
 
+	if len(resolved) == 1 && len(failed) == 0 {
+		match := resolved[0]
+		duration := time.Duration(match.Video.Duration) * time.Second
 		embed := &discordgo.MessageEmbed{
-			Title:       "🔍 Search Results",
-			Description: builder.String(),
+			Title:       "✅ Added to Queue",
+			Description: fmt.Sprintf("[%s](%s)", match.Video.Title, match.Video.WebURL),
 			Color:       0x1DB954,
-			Footer:      &discordgo.MessageEmbedFooter{Text: "Click a number below to choose a song"},
+			Fields: []*discordgo.MessageEmbedField{
+				{Name: "Requested By", Value: fmt.Sprintf("<@%s>", userID), Inline: true},
+				{Name: "Duration", Value: fmtDuration(duration), Inline: true},
+				{Name: "Match Confidence", Value: fmtConfidence(match.Confidence), Inline: true},
+				{Name: "Matched From", Value: fmt.Sprintf("%s — %s (%s)", match.Source.Artist, match.Source.Title, provider.Name())},
+			},
+			Footer: &discordgo.MessageEmbedFooter{
+				Text: "Use /queue show to view the current queue.",
+			},
 		}
+		sendEmbedFollowup(discord, i, embed)
+		return
+	}
 
-		sendEmbedFollowupWithComponents(discord, i, embed, components)
-	}()
+	var builder strings.Builder
+	for idx, match := range resolved {
+		fmt.Fprintf(&builder, "**%d.** [%s](%s) — %s\n", idx+1, match.Video.Title, match.Video.WebURL, fmtConfidence(match.Confidence))
+	}
+	if len(failed) > 0 {
+		builder.WriteString("\n**Not found on YouTube or over this server's limits:**\n")
+		for _, track := range failed {
+			fmt.Fprintf(&builder, "• %s — %s\n", track.Artist, track.Title)
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("✅ Added %d Tracks from %s", len(resolved), provider.Name()),
+		Description: truncateDescription(builder.String()),
+		Color:       0x1DB954,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Requested By", Value: fmt.Sprintf("<@%s>", userID), Inline: true},
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Percentages show how closely each YouTube match fits the original track.",
+		},
+	}
+	sendEmbedFollowup(discord, i, embed)
+}
+
+func fmtConfidence(confidence float64) string {
+	return fmt.Sprintf("%.0f%%", confidence*100)
+}
+
+// Discord rejects embeds whose description is over 4096 characters
+func truncateDescription(s string) string {
+	const maxLen = 4000
+	if len(s) <= maxLen {
+		return s
+	}
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "\n…"
 }
 
 func sendErrorFollowup(discord *discordgo.Session, i *discordgo.InteractionCreate, message string) {
@@ -121,7 +376,7 @@ func sendErrorFollowup(discord *discordgo.Session, i *discordgo.InteractionCreat
 		},
 	})
 	if err != nil {
-		log.Printf("Failed to send error followup: %v", err)
+		logWarnf("Failed to send error followup: %v", err)
 	}
 }
 
@@ -131,34 +386,94 @@ func HandlePlaySelection(discord *discordgo.Session, i *discordgo.InteractionCre
 	}
 	userID := GetUserID(i)
 
-	customID := i.MessageComponentData().CustomID
-	if !strings.HasPrefix(customID, "select_video_") {
+	sessionID, _ := searchSessionFromCustomID(i.MessageComponentData().CustomID)
+	session, ok := GetSearchSession(sessionID)
+	if !ok {
+		respondEphemeral(discord, i, "❌ These search results have expired. Use /play to search again.")
+		return
+	}
+	if session.OwnerID != userID {
+		respondEphemeral(discord, i, "❌ Only the person who searched can pick from these results. Use /play to run your own search.")
+		return
+	}
+	if !requireSameVoiceChannel(discord, i) {
 		return
 	}
 
-	indexStr := strings.TrimPrefix(customID, "select_video_")
-	index, _ := strconv.Atoi(indexStr)
+	var selected []VideoInfo
+	for _, value := range i.MessageComponentData().Values {
+		index, err := strconv.Atoi(value)
+		if err != nil || index < 0 || index >= len(session.Videos) {
+			continue
+		}
+		selected = append(selected, session.Videos[index])
+	}
 
-	videos, ok := GetSearchResults(userID)
+	if len(selected) == 0 {
+		respondEphemeral(discord, i, "❌ Invalid selection. Please try again.")
+		return
+	}
 
-	if !ok || index <= 0 || index > len(videos) {
-		discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "❌ Invalid selection. Please try again.",
-			},
-		})
+	DeleteSearchSession(session.ID)
+
+	// Joining the voice channel can take longer than Discord waits for a response
+	err := discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+	if err != nil {
+		logWarnf("Failed to defer search selection: %v", err)
 		return
 	}
 
-	selected := videos[index-1]
-	GlobalQueue.Add(discord, i.Interaction, i.GuildID, i.ChannelID, userID, selected)
+	var added []VideoInfo
+	var rejected []string
+	var duplicates []*DuplicateTrackError
+	for _, video := range selected {
+		if err := GlobalQueue.Add(discord, i.Interaction, i.GuildID, i.ChannelID, userID, video); err != nil {
+			var dup *DuplicateTrackError
+			if errors.As(err, &dup) && dup.Policy == DuplicateWarn {
+				duplicates = append(duplicates, dup)
+				continue
+			}
+			rejected = append(rejected, err.Error())
+			continue
+		}
+		added = append(added, video)
+	}
+	defer sendDuplicatePrompt(discord, i, userID, duplicates)
+
+	var builder strings.Builder
+	var total time.Duration
+	for idx, video := range added {
+		duration := time.Duration(video.Duration) * time.Second
+		total += duration
+		fmt.Fprintf(&builder, "**%d.** [%s](%s) (%s)\n", idx+1, video.Title, video.WebURL, fmtDuration(duration))
+	}
+	if len(rejected) > 0 {
+		builder.WriteString("\n**Not added:**\n")
+		for _, reason := range rejected {
+			fmt.Fprintf(&builder, "• %s\n", reason)
+		}
+	}
+
+	title := "✅ Added to Queue"
+	color := 0x1DB954
+	switch {
+	case len(added) == 0 && len(rejected) == 0:
+		title = "⚠️ Already Queued"
+		color = 0xE03C3C
+		builder.WriteString("Everything you picked is already queued or was just played.")
+	case len(added) == 0:
+		title = "❌ Nothing Added"
+		color = 0xE03C3C
+	case len(added) > 1:
+		title = fmt.Sprintf("✅ Added %d Songs to Queue", len(added))
+	}
 
-	duration := time.Duration(selected.Duration) * time.Second
 	embed := &discordgo.MessageEmbed{
-		Title:       "✅ Added to Queue",
-		Description: fmt.Sprintf("[%s](%s)", selected.Title, selected.WebURL),
-		Color:       0x1DB954,
+		Title:       title,
+		Description: truncateDescription(builder.String()),
+		Color:       color,
 		Fields: []*discordgo.MessageEmbedField{
 			{
 				Name:   "Requested By",
@@ -167,23 +482,67 @@ func HandlePlaySelection(discord *discordgo.Session, i *discordgo.InteractionCre
 			},
 			{
 				Name:   "Duration",
-				Value:  fmtDuration(duration),
+				Value:  fmtDuration(total),
 				Inline: true,
 			},
 		},
 		Footer: &discordgo.MessageEmbedFooter{
-			Text: "Use /queue to view the current queue.",
+			Text: "Use /queue show to view the current queue.",
 		},
 	}
 
-	discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
+	_, disabledComponents := buildSearchResultsMessage(session, session.Page, true)
+	_, err = discord.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &disabledComponents,
+	})
+	if err != nil {
+		logWarnf("Failed to respond to search selection: %v", err)
+	}
+}
+
+func HandleSearchPage(discord *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := GetUserID(i)
+	sessionID, page := searchSessionFromCustomID(i.MessageComponentData().CustomID)
+
+	session, ok := GetSearchSession(sessionID)
+	if !ok || page < 0 || page*searchPageSize >= len(session.Videos) {
+		respondEphemeral(discord, i, "❌ These search results are no longer available. Use /play to search again.")
+		return
+	}
+	if session.OwnerID != userID {
+		respondEphemeral(discord, i, "❌ Only the person who searched can page through these results.")
+		return
+	}
+
+	mu.Lock()
+	session.Page = page
+	mu.Unlock()
+
+	embed, components := buildSearchResultsMessage(session, page, false)
+	err := discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
 		Data: &discordgo.InteractionResponseData{
-			Embeds: []*discordgo.MessageEmbed{embed},
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
 		},
 	})
+	if err != nil {
+		logWarnf("Failed to change search results page: %v", err)
+	}
+}
 
-	DeleteSearchResults(userID)
+func respondEphemeral(discord *discordgo.Session, i *discordgo.InteractionCreate, message string) {
+	err := discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: message,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		logWarnf("Failed to send ephemeral response: %v", err)
+	}
 }
 
 func sendEmbedFollowup(discord *discordgo.Session, i *discordgo.InteractionCreate, embed *discordgo.MessageEmbed) {
@@ -191,16 +550,18 @@ func sendEmbedFollowup(discord *discordgo.Session, i *discordgo.InteractionCreat
 		Embeds: []*discordgo.MessageEmbed{embed},
 	})
 	if err != nil {
-		log.Printf("Failed to send followup embed: %v", err)
+		logWarnf("Failed to send followup embed: %v", err)
 	}
 }
 
-func sendEmbedFollowupWithComponents(discord *discordgo.Session, i *discordgo.InteractionCreate, embed *discordgo.MessageEmbed, components []discordgo.MessageComponent) {
-	_, err := discord.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
+func sendEmbedFollowupWithComponents(discord *discordgo.Session, i *discordgo.InteractionCreate, embed *discordgo.MessageEmbed, components []discordgo.MessageComponent) *discordgo.Message {
+	msg, err := discord.FollowupMessageCreate(i.Interaction, true, &discordgo.WebhookParams{
 		Embeds:     []*discordgo.MessageEmbed{embed},
 		Components: components,
 	})
 	if err != nil {
-		log.Printf("Failed to send followup embed with components: %v", err)
+		logWarnf("Failed to send followup embed with components: %v", err)
+		return nil
 	}
+	return msg
 }
@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"layeh.com/gopus"
+)
+
+// Overridden by ApplyConfig
+var FFmpegPath = "ffmpeg"
+
+// Same audio settings dgvoice uses, Discord expects 20ms stereo opus frames at 48kHz
+const (
+	audioChannels  = 2
+	audioFrameRate = 48000
+	audioFrameSize = 960
+	audioMaxBytes  = (audioFrameSize * 2) * 2
+	frameDuration  = 20 * time.Millisecond
+)
+
+// Works like dgvoice.PlayAudioFile, but checks the guild's pause and volume state between frames and
+// records how far into the track playback has got. Returns true if playback was cut short by stop, and
+// errVoiceLost if the voice connection went away for good.
+func PlayAudioFile(vc *discordgo.VoiceConnection, guildID, filename string, start time.Duration, stop <-chan bool) (bool, error) {
+	args := []string{}
+	if start > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(start.Seconds(), 'f', 3, 64))
+	}
+	args = append(args, "-i", filename, "-f", "s16le", "-ar", strconv.Itoa(audioFrameRate), "-ac", strconv.Itoa(audioChannels), "pipe:1")
+
+	cmd := exec.Command(FFmpegPath, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return false, fmt.Errorf("failed to get ffmpeg stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return false, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	encoder, err := gopus.NewEncoder(audioFrameRate, audioChannels, gopus.Audio)
+	if err != nil {
+		return false, fmt.Errorf("failed to create opus encoder: %w", err)
+	}
+
+	setSpeaking(vc, true)
+	defer setSpeaking(vc, false)
+
+	reader := bufio.NewReaderSize(stdout, 16384)
+	position := start
+	GlobalQueue.SetPosition(guildID, position)
+
+	for {
+		select {
+		case <-stop:
+			return true, nil
+		default:
+		}
+
+		if GlobalQueue.IsPaused(guildID) {
+			setSpeaking(vc, false)
+			for GlobalQueue.IsPaused(guildID) {
+				select {
+				case <-stop:
+					return true, nil
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+			setSpeaking(vc, true)
+		}
+
+		pcm := make([]int16, audioFrameSize*audioChannels)
+		err := binary.Read(reader, binary.LittleEndian, &pcm)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("error reading from ffmpeg stdout: %w", err)
+		}
+
+		applyVolume(pcm, GlobalQueue.GetVolume(guildID))
+
+		opus, err := encoder.Encode(pcm, audioFrameSize, audioMaxBytes)
+		if err != nil {
+			return false, fmt.Errorf("opus encoding failed: %w", err)
+		}
+
+		if stopped, err := sendOpusFrame(guildID, opus, stop); stopped || err != nil {
+			return stopped, err
+		}
+
+		position += frameDuration
+		GlobalQueue.SetPosition(guildID, position)
+	}
+}
+
+func applyVolume(pcm []int16, volume int) {
+	if volume == 100 {
+		return
+	}
+	scale := float64(volume) / 100
+	for idx, sample := range pcm {
+		scaled := float64(sample) * scale
+		pcm[idx] = int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, scaled)))
+	}
+}
+
+func setSpeaking(vc *discordgo.VoiceConnection, speaking bool) {
+	if err := vc.Speaking(speaking); err != nil {
+		logWarnf("Couldn't set speaking to %t in guild %s: %v", speaking, vc.GuildID, err)
+	}
+}
@@ -0,0 +1,560 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type PlaylistScope string
+
+const (
+	PlaylistPersonal PlaylistScope = "personal"
+	PlaylistServer   PlaylistScope = "server"
+)
+
+const (
+	playlistBucket        = "playlists"
+	maxPlaylistTracks     = 200
+	maxPlaylistNameLength = 50
+)
+
+// Returned from inside a Store.Modify to abort the write
+var (
+	errPlaylistExists   = errors.New("playlist already exists")
+	errPlaylistMissing  = errors.New("playlist no longer exists")
+	errPlaylistFull     = errors.New("playlist is full")
+	errPlaylistPosition = errors.New("no track at that position")
+)
+
+type Playlist struct {
+	Name      string        `json:"name"`
+	Scope     PlaylistScope `json:"scope"`
+	OwnerID   string        `json:"owner_id"`
+	GuildID   string        `json:"guild_id,omitempty"`
+	Tracks    []VideoInfo   `json:"tracks"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+type playlistOptions struct {
+	Name      string
+	Scope     PlaylistScope
+	Link      string
+	FromQueue bool
+	Position  int
+}
+
+// Personal playlists follow the user across servers, server playlists are shared by everyone in the guild
+func playlistKeyPrefix(scope PlaylistScope, guildID, userID string) string {
+	if scope == PlaylistServer {
+		return "guild:" + guildID + ":"
+	}
+	return "user:" + userID + ":"
+}
+
+func playlistKey(scope PlaylistScope, guildID, userID, name string) string {
+	return playlistKeyPrefix(scope, guildID, userID) + strings.ToLower(name)
+}
+
+func (p Playlist) key() string {
+	return playlistKey(p.Scope, p.GuildID, p.OwnerID, p.Name)
+}
+
+func (p Playlist) duration() time.Duration {
+	var total time.Duration
+	for _, track := range p.Tracks {
+		total += time.Duration(track.Duration) * time.Second
+	}
+	return total
+}
+
+func (p Playlist) label() string {
+	if p.Scope == PlaylistServer {
+		return fmt.Sprintf("**%s** (server)", p.Name)
+	}
+	return fmt.Sprintf("**%s** (personal)", p.Name)
+}
+
+// Without an explicit scope, a personal playlist wins over a server one with the same name
+func findPlaylist(guildID, userID, name string, scope PlaylistScope) (Playlist, bool, error) {
+	scopes := []PlaylistScope{PlaylistPersonal, PlaylistServer}
+	if scope != "" {
+		scopes = []PlaylistScope{scope}
+	}
+	for _, sc := range scopes {
+		var playlist Playlist
+		found, err := GlobalStore.Get(playlistBucket, playlistKey(sc, guildID, userID, name), &playlist)
+		if err != nil || found {
+			return playlist, found, err
+		}
+	}
+	return Playlist{}, false, nil
+}
+
+func listPlaylists(scope PlaylistScope, guildID, userID string) ([]Playlist, error) {
+	var playlists []Playlist
+	err := GlobalStore.ForEach(playlistBucket, playlistKeyPrefix(scope, guildID, userID), func(key string, data []byte) error {
+		var playlist Playlist
+		if err := json.Unmarshal(data, &playlist); err != nil {
+			logWarnf("Skipping unreadable playlist %s: %v", key, err)
+			return nil
+		}
+		playlists = append(playlists, playlist)
+		return nil
+	})
+	return playlists, err
+}
+
+func canEditPlaylist(i *discordgo.InteractionCreate, playlist Playlist) bool {
+	if playlist.Scope == PlaylistPersonal {
+		return playlist.OwnerID == GetUserID(i)
+	}
+	return playlist.OwnerID == GetUserID(i) || isDJ(i)
+}
+
+func parsePlaylistOptions(options []*discordgo.ApplicationCommandInteractionDataOption) playlistOptions {
+	var opts playlistOptions
+	for _, option := range options {
+		switch option.Name {
+		case "name":
+			opts.Name = strings.TrimSpace(option.StringValue())
+		case "scope":
+			opts.Scope = PlaylistScope(option.StringValue())
+		case "link":
+			opts.Link = strings.TrimSpace(option.StringValue())
+		case "from_queue":
+			opts.FromQueue = option.BoolValue()
+		case "position":
+			opts.Position = int(option.IntValue())
+		}
+	}
+	return opts
+}
+
+func HandlePlaylistCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		return
+	}
+	sub := options[0]
+	opts := parsePlaylistOptions(sub.Options)
+
+	switch sub.Name {
+	case "create":
+		handlePlaylistCreate(s, i, opts)
+	case "add":
+		handlePlaylistAdd(s, i, opts)
+	case "remove":
+		handlePlaylistRemove(s, i, opts)
+	case "show":
+		handlePlaylistShow(s, i, opts)
+	case "play":
+		handlePlaylistPlay(s, i, opts)
+	case "delete":
+		handlePlaylistDelete(s, i, opts)
+	}
+}
+
+// Looks up the playlist named in the command, responding with an error if it can't be used
+func requirePlaylist(s *discordgo.Session, i *discordgo.InteractionCreate, opts playlistOptions, edit bool) (Playlist, bool) {
+	playlist, found, err := findPlaylist(i.GuildID, GetUserID(i), opts.Name, opts.Scope)
+	if err != nil {
+		logErrorf("Failed to load playlist %q: %v", opts.Name, err)
+		respondEphemeral(s, i, "❌ Couldn't load that playlist, please try again.")
+		return Playlist{}, false
+	}
+	if !found {
+		respondEphemeral(s, i, fmt.Sprintf("❌ There's no playlist called **%s**. Use `/playlist show` to see your playlists.", opts.Name))
+		return Playlist{}, false
+	}
+	if edit && !canEditPlaylist(i, playlist) {
+		respondEphemeral(s, i, fmt.Sprintf("🔒 Only <@%s> or a DJ can change %s.", playlist.OwnerID, playlist.label()))
+		return Playlist{}, false
+	}
+	return playlist, true
+}
+
+func handlePlaylistCreate(s *discordgo.Session, i *discordgo.InteractionCreate, opts playlistOptions) {
+	if opts.Scope == "" {
+		opts.Scope = PlaylistPersonal
+	}
+	if opts.Name == "" || len([]rune(opts.Name)) > maxPlaylistNameLength {
+		respondEphemeral(s, i, fmt.Sprintf("❌ Playlist names must be between 1 and %d characters.", maxPlaylistNameLength))
+		return
+	}
+
+	userID := GetUserID(i)
+	if _, found, err := findPlaylist(i.GuildID, userID, opts.Name, opts.Scope); err != nil || found {
+		if err != nil {
+			logErrorf("Failed to check for playlist %q: %v", opts.Name, err)
+		}
+		respondEphemeral(s, i, fmt.Sprintf("❌ A %s playlist called **%s** already exists.", opts.Scope, opts.Name))
+		return
+	}
+
+	now := time.Now()
+	playlist := Playlist{
+		Name:      opts.Name,
+		Scope:     opts.Scope,
+		OwnerID:   userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if opts.Scope == PlaylistServer {
+		playlist.GuildID = i.GuildID
+	}
+	created := playlist
+	err := GlobalStore.Modify(playlistBucket, playlist.key(), &playlist, func(found bool) error {
+		if found {
+			return errPlaylistExists
+		}
+		playlist = created
+		return nil
+	})
+	if errors.Is(err, errPlaylistExists) {
+		respondEphemeral(s, i, fmt.Sprintf("❌ A %s playlist called **%s** already exists.", opts.Scope, opts.Name))
+		return
+	}
+	if err != nil {
+		logErrorf("Failed to save playlist %q: %v", playlist.Name, err)
+		respondEphemeral(s, i, "❌ Couldn't save the playlist, please try again.")
+		return
+	}
+
+	respondPlaylistEmbed(s, i, "📁 Playlist Created", fmt.Sprintf("Created %s. Add tracks with `/playlist add`.", playlist.label()))
+}
+
+func handlePlaylistAdd(s *discordgo.Session, i *discordgo.InteractionCreate, opts playlistOptions) {
+	playlist, ok := requirePlaylist(s, i, opts, true)
+	if !ok {
+		return
+	}
+
+	// Looking up a link can take longer than Discord waits for a response
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		logWarnf("Failed to defer interaction: %v", err)
+		return
+	}
+
+	var tracks []VideoInfo
+	switch {
+	case opts.Link != "":
+		if !isYouTubeLink(opts.Link) {
+			sendErrorFollowup(s, i, "Only YouTube links can be added to playlists.")
+			return
+		}
+		video, err := YoutubeGetInfo(sanitizeYouTubeURL(opts.Link))
+		if err != nil {
+			logWarnf("Failed to get video info for %s: %v", opts.Link, err)
+			sendErrorFollowup(s, i, "Failed to get video info. Please make sure the link is valid.")
+			return
+		}
+		tracks = append(tracks, video)
+	case opts.FromQueue:
+		tracks = GlobalQueue.Get(GlobalQueue.GetTextChannel(i.GuildID))
+		if len(tracks) == 0 {
+			sendErrorFollowup(s, i, "The queue is empty.")
+			return
+		}
+	default:
+		current, ok := GlobalQueue.GetCurrentlyPlaying(i.GuildID)
+		if !ok || current.Title == "" {
+			sendErrorFollowup(s, i, "Nothing is playing. Give a link or use `from_queue` to add the queue instead.")
+			return
+		}
+		tracks = append(tracks, current)
+	}
+
+	// The lookup above can take seconds, so the tracks are added to whatever the playlist holds by now
+	err = GlobalStore.Modify(playlistBucket, playlist.key(), &playlist, func(found bool) error {
+		if !found {
+			return errPlaylistMissing
+		}
+		if len(playlist.Tracks)+len(tracks) > maxPlaylistTracks {
+			return errPlaylistFull
+		}
+		for _, track := range tracks {
+			track.RequestedBy = ""
+			playlist.Tracks = append(playlist.Tracks, track)
+		}
+		playlist.UpdatedAt = time.Now()
+		return nil
+	})
+	switch {
+	case errors.Is(err, errPlaylistMissing):
+		sendErrorFollowup(s, i, fmt.Sprintf("%s was deleted in the meantime.", playlist.label()))
+		return
+	case errors.Is(err, errPlaylistFull):
+		sendErrorFollowup(s, i, fmt.Sprintf("Playlists can hold up to %d tracks, %s has %d.", maxPlaylistTracks, playlist.label(), len(playlist.Tracks)))
+		return
+	case err != nil:
+		logErrorf("Failed to save playlist %q: %v", playlist.Name, err)
+		sendErrorFollowup(s, i, "Couldn't save the playlist, please try again.")
+		return
+	}
+
+	description := fmt.Sprintf("Added [%s](%s) to %s.", tracks[0].Title, tracks[0].WebURL, playlist.label())
+	if len(tracks) > 1 {
+		description = fmt.Sprintf("Added %d tracks to %s.", len(tracks), playlist.label())
+	}
+	sendEmbedFollowup(s, i, &discordgo.MessageEmbed{
+		Title:       "📁 Playlist Updated",
+		Description: description,
+		Color:       0x1DB954,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("%d tracks, %s total", len(playlist.Tracks), fmtDuration(playlist.duration())),
+		},
+	})
+}
+
+func handlePlaylistRemove(s *discordgo.Session, i *discordgo.InteractionCreate, opts playlistOptions) {
+	playlist, ok := requirePlaylist(s, i, opts, true)
+	if !ok {
+		return
+	}
+
+	var removed VideoInfo
+	err := GlobalStore.Modify(playlistBucket, playlist.key(), &playlist, func(found bool) error {
+		if !found {
+			return errPlaylistMissing
+		}
+		if opts.Position < 1 || opts.Position > len(playlist.Tracks) {
+			return errPlaylistPosition
+		}
+		removed = playlist.Tracks[opts.Position-1]
+		playlist.Tracks = append(playlist.Tracks[:opts.Position-1], playlist.Tracks[opts.Position:]...)
+		playlist.UpdatedAt = time.Now()
+		return nil
+	})
+	switch {
+	case errors.Is(err, errPlaylistMissing):
+		respondEphemeral(s, i, fmt.Sprintf("❌ %s was deleted in the meantime.", playlist.label()))
+		return
+	case errors.Is(err, errPlaylistPosition):
+		respondEphemeral(s, i, fmt.Sprintf("❌ %s only has %d tracks.", playlist.label(), len(playlist.Tracks)))
+		return
+	case err != nil:
+		logErrorf("Failed to save playlist %q: %v", playlist.Name, err)
+		respondEphemeral(s, i, "❌ Couldn't save the playlist, please try again.")
+		return
+	}
+
+	respondPlaylistEmbed(s, i, "📁 Playlist Updated", fmt.Sprintf("Removed [%s](%s) from %s.", removed.Title, removed.WebURL, playlist.label()))
+}
+
+func handlePlaylistShow(s *discordgo.Session, i *discordgo.InteractionCreate, opts playlistOptions) {
+	if opts.Name == "" {
+		showPlaylistList(s, i)
+		return
+	}
+
+	playlist, ok := requirePlaylist(s, i, opts, false)
+	if !ok {
+		return
+	}
+
+	var builder strings.Builder
+	for idx, track := range playlist.Tracks {
+		duration := time.Duration(track.Duration) * time.Second
+		fmt.Fprintf(&builder, "**%d.** [%s](%s) (%s)\n", idx+1, track.Title, track.WebURL, fmtDuration(duration))
+	}
+	if len(playlist.Tracks) == 0 {
+		builder.WriteString("This playlist is empty. Add tracks with `/playlist add`.")
+	}
+
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       fmt.Sprintf("📁 %s", playlist.Name),
+					Description: truncateDescription(builder.String()),
+					Color:       0x1DB954,
+					Fields: []*discordgo.MessageEmbedField{
+						{Name: "Owner", Value: fmt.Sprintf("<@%s>", playlist.OwnerID), Inline: true},
+						{Name: "Scope", Value: string(playlist.Scope), Inline: true},
+						{Name: "Duration", Value: fmtDuration(playlist.duration()), Inline: true},
+					},
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+func showPlaylistList(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	userID := GetUserID(i)
+	personal, err := listPlaylists(PlaylistPersonal, i.GuildID, userID)
+	if err == nil {
+		var server []Playlist
+		server, err = listPlaylists(PlaylistServer, i.GuildID, userID)
+		personal = append(personal, server...)
+	}
+	if err != nil {
+		logErrorf("Failed to list playlists: %v", err)
+		respondEphemeral(s, i, "❌ Couldn't load playlists, please try again.")
+		return
+	}
+
+	var builder strings.Builder
+	for _, playlist := range personal {
+		fmt.Fprintf(&builder, "%s — %d tracks, %s\n", playlist.label(), len(playlist.Tracks), fmtDuration(playlist.duration()))
+	}
+	if len(personal) == 0 {
+		builder.WriteString("No playlists yet. Create one with `/playlist create`.")
+	}
+
+	respondPlaylistEmbed(s, i, "📁 Playlists", truncateDescription(builder.String()))
+}
+
+func handlePlaylistPlay(s *discordgo.Session, i *discordgo.InteractionCreate, opts playlistOptions) {
+	playlist, ok := requirePlaylist(s, i, opts, false)
+	if !ok {
+		return
+	}
+	if len(playlist.Tracks) == 0 {
+		respondEphemeral(s, i, fmt.Sprintf("❌ %s is empty.", playlist.label()))
+		return
+	}
+	if !requireSameVoiceChannel(s, i) {
+		return
+	}
+
+	userID := GetUserID(i)
+	if findUserVoiceChannel(s, i.GuildID, userID) == "" && !GlobalQueue.IsInVoiceChannel(i.GuildID) {
+		respondEphemeral(s, i, "❌ You need to be in a voice channel to play a playlist.")
+		return
+	}
+
+	// Joining the voice channel can take longer than Discord waits for a response
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		logWarnf("Failed to defer interaction: %v", err)
+		return
+	}
+
+	var added int
+	var rejected []string
+	var duplicates []*DuplicateTrackError
+	for _, track := range playlist.Tracks {
+		if err := GlobalQueue.Add(s, i.Interaction, i.GuildID, i.ChannelID, userID, track); err != nil {
+			var dup *DuplicateTrackError
+			if errors.As(err, &dup) && dup.Policy == DuplicateWarn {
+				duplicates = append(duplicates, dup)
+				continue
+			}
+			rejected = append(rejected, err.Error())
+			continue
+		}
+		added++
+	}
+	defer sendDuplicatePrompt(s, i, userID, duplicates)
+
+	if added == 0 && len(rejected) > 0 {
+		sendErrorFollowup(s, i, truncateDescription(strings.Join(rejected, "\n")))
+		return
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Queued %d of %d tracks from %s.\n", added, len(playlist.Tracks), playlist.label())
+	if len(rejected) > 0 {
+		builder.WriteString("\n**Not added:**\n")
+		for _, reason := range rejected {
+			fmt.Fprintf(&builder, "• %s\n", reason)
+		}
+	}
+	sendEmbedFollowup(s, i, &discordgo.MessageEmbed{
+		Title:       "📁 Playing Playlist",
+		Description: truncateDescription(builder.String()),
+		Color:       0x1DB954,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Requested By", Value: fmt.Sprintf("<@%s>", userID), Inline: true},
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Use /queue show to view the current queue.",
+		},
+	})
+}
+
+func handlePlaylistDelete(s *discordgo.Session, i *discordgo.InteractionCreate, opts playlistOptions) {
+	playlist, ok := requirePlaylist(s, i, opts, true)
+	if !ok {
+		return
+	}
+	if err := GlobalStore.Delete(playlistBucket, playlist.key()); err != nil {
+		logErrorf("Failed to delete playlist %q: %v", playlist.Name, err)
+		respondEphemeral(s, i, "❌ Couldn't delete the playlist, please try again.")
+		return
+	}
+	respondPlaylistEmbed(s, i, "🗑️ Playlist Deleted", fmt.Sprintf("Deleted %s.", playlist.label()))
+}
+
+func respondPlaylistEmbed(s *discordgo.Session, i *discordgo.InteractionCreate, title, description string) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       title,
+					Description: description,
+					Color:       0x1DB954,
+				},
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+	if err != nil {
+		logWarnf("Failed to respond to playlist command: %v", err)
+	}
+}
+
+func HandlePlaylistAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		respondAutocomplete(s, i, nil)
+		return
+	}
+
+	var typed string
+	for _, option := range options[0].Options {
+		if option.Name == "name" && option.Focused {
+			typed = strings.ToLower(strings.TrimSpace(option.StringValue()))
+		}
+	}
+
+	userID := GetUserID(i)
+	personal, _ := listPlaylists(PlaylistPersonal, i.GuildID, userID)
+	server, _ := listPlaylists(PlaylistServer, i.GuildID, userID)
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	seen := make(map[string]bool)
+	for _, playlist := range append(personal, server...) {
+		lower := strings.ToLower(playlist.Name)
+		if seen[lower] || !strings.Contains(lower, typed) {
+			continue
+		}
+		seen[lower] = true
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: playlist.Name, Value: playlist.Name})
+		if len(choices) == 25 {
+			break
+		}
+	}
+	respondAutocomplete(s, i, choices)
+}
+
+func playlistScopeChoices() []*discordgo.ApplicationCommandOptionChoice {
+	return []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "Personal", Value: string(PlaylistPersonal)},
+		{Name: "Server", Value: string(PlaylistServer)},
+	}
+}
@@ -3,8 +3,8 @@ package bot
 import (
 	"context"
 	"fmt"
-	"log"
 	"math/rand"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,8 +25,22 @@ type Queue struct {
 	pausedTrack      map[string]VideoInfo
 	lastActivity     map[string]time.Time
 	idleCancelFuncs  map[string]context.CancelFunc
+	idleReasons      map[string]idleReason
+	autoPaused       map[string]bool
 	shuffleMode      map[string]bool
 	currentlyPlaying map[string]VideoInfo
+	loopEnabled      map[string]bool
+	volume           map[string]int
+	position         map[string]time.Duration
+	nowPlayingPanels map[string]*discordgo.Message
+	skipVotes        map[string]*skipVote
+	pending          map[string][]VideoInfo
+	history          map[string][]VideoInfo
+	textChannels     map[string]string
+	resumePoints     map[string]resumePoint
+	reconnecting     map[string]bool
+	suspended        map[string]bool
+	voiceChannels    map[string]string
 }
 
 func NewQueue() *Queue {
@@ -42,50 +56,87 @@ func NewQueue() *Queue {
 		pausedTrack:      make(map[string]VideoInfo),
 		lastActivity:     make(map[string]time.Time),
 		idleCancelFuncs:  make(map[string]context.CancelFunc),
+		idleReasons:      make(map[string]idleReason),
+		autoPaused:       make(map[string]bool),
 		shuffleMode:      make(map[string]bool),
 		currentlyPlaying: make(map[string]VideoInfo),
+		loopEnabled:      make(map[string]bool),
+		volume:           make(map[string]int),
+		position:         make(map[string]time.Duration),
+		nowPlayingPanels: make(map[string]*discordgo.Message),
+		skipVotes:        make(map[string]*skipVote),
+		pending:          make(map[string][]VideoInfo),
+		history:          make(map[string][]VideoInfo),
+		textChannels:     make(map[string]string),
+		resumePoints:     make(map[string]resumePoint),
+		reconnecting:     make(map[string]bool),
+		suspended:        make(map[string]bool),
+		voiceChannels:    make(map[string]string),
 	}
 }
 
 var GlobalQueue = NewQueue()
 
-func (q *Queue) Add(discord *discordgo.Session, interaction *discordgo.Interaction, guildID, channelID, userID string, video VideoInfo) {
+// Callers must have already responded to (or deferred) the interaction, progress is reported through followups.
+// Returns a *QueueLimitError or *DuplicateTrackError if the track can't be queued.
+func (q *Queue) Add(discord *discordgo.Session, interaction *discordgo.Interaction, guildID, channelID, userID string, video VideoInfo) error {
 	video.RequestedBy = userID
+	return q.add(discord, interaction, guildID, channelID, userID, video, false)
+}
 
-	err := discord.InteractionRespond(interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("🎵 **%s** requested by <@%s>. Fetching...", video.Title, userID),
-		},
-	})
-	if err != nil {
-		log.Printf("Failed to send interaction response: %v", err)
+// Same as Add but skips the duplicate check, for when the user has confirmed they want it queued again
+func (q *Queue) AddAnyway(discord *discordgo.Session, interaction *discordgo.Interaction, guildID, channelID, userID string, video VideoInfo) error {
+	video.RequestedBy = userID
+	return q.add(discord, interaction, guildID, channelID, userID, video, true)
+}
+
+// Same as Add but credits the track to requesterID, e.g. whoever queued it before it was exported. The limits
+// apply to the requester, userID is only used to find a voice channel to join.
+func (q *Queue) AddFor(discord *discordgo.Session, interaction *discordgo.Interaction, guildID, channelID, userID, requesterID string, video VideoInfo) error {
+	video.RequestedBy = requesterID
+	return q.add(discord, interaction, guildID, channelID, userID, video, false)
+}
+
+// video.RequestedBy must already be set
+func (q *Queue) add(discord *discordgo.Session, interaction *discordgo.Interaction, guildID, channelID, userID string, video VideoInfo, allowDuplicate bool) error {
+	q.Lock()
+	if err := q.checkLimitsLocked(guildID, channelID, video.RequestedBy, video); err != nil {
+		q.Unlock()
+		return err
+	}
+	if !allowDuplicate {
+		if err := q.checkDuplicateLocked(guildID, channelID, video); err != nil {
+			q.Unlock()
+			return err
+		}
 	}
+	q.pending[channelID] = append(q.pending[channelID], video)
+	q.textChannels[guildID] = channelID
+	q.Unlock()
 
 	if !q.IsInVoiceChannel(guildID) {
 		voiceChannelID := findUserVoiceChannel(discord, guildID, userID)
 		if voiceChannelID != "" {
 			err := JoinVoiceChannel(discord, guildID, voiceChannelID)
 			if err != nil {
-				log.Printf("Failed to join voice channel immediately: %v", err)
-			} else {
-				// StartIdleMonitor(guildID, channelID, discord)
+				logWarnf("Failed to join voice channel immediately: %v", err)
 			}
 		} else {
-			log.Printf("User %s is not in a voice channel, cannot join immediately", userID)
+			logDebugf("User %s is not in a voice channel, cannot join immediately", userID)
 		}
 	}
 
 	go func(v VideoInfo) {
 		filepath, err := YoutubeDownloadAudio(v.WebURL, v.Title)
 		if err != nil {
-			log.Printf("Failed to download audio for %s: %v", v.Title, err)
+			logWarnf("Failed to download audio for %s: %v", v.Title, err)
+			q.finishPending(channelID, v)
 
 			_, err2 := discord.FollowupMessageCreate(interaction, false, &discordgo.WebhookParams{
 				Content: fmt.Sprintf("⚠️ Failed to download **%s**.", v.Title),
 			})
 			if err2 != nil {
-				log.Printf("Failed to send follow-up message: %v", err2)
+				logWarnf("Failed to send follow-up message: %v", err2)
 			}
 			return
 		}
@@ -95,19 +146,93 @@ func (q *Queue) Add(discord *discordgo.Session, interaction *discordgo.Interacti
 		if q.requestedBy[channelID] == nil {
 			q.requestedBy[channelID] = make(map[string]struct{})
 		}
-		q.requestedBy[channelID][userID] = struct{}{}
+		q.requestedBy[channelID][v.RequestedBy] = struct{}{}
+		if GlobalSettings.Get(guildID).FairQueue {
+			q.queues[channelID] = fairOrder(q.queues[channelID], q.requestedBy[channelID])
+		}
 		q.downloadedFiles[v.Title] = filepath
 		q.Unlock()
+		q.finishPending(channelID, v)
 
 		_, err2 := discord.FollowupMessageCreate(interaction, false, &discordgo.WebhookParams{
 			Content: fmt.Sprintf("✅ **%s** ready!", v.Title),
 		})
 		if err2 != nil {
-			log.Printf("Failed to send follow-up message: %v", err2)
+			logWarnf("Failed to send follow-up message: %v", err2)
 		}
 
 		StartPlaybackIfNotActive(discord, guildID, channelID)
 	}(video)
+	return nil
+}
+
+func (q *Queue) finishPending(channelID string, video VideoInfo) {
+	q.Lock()
+	defer q.Unlock()
+	pending := q.pending[channelID]
+	for idx, item := range pending {
+		if item.WebURL == video.WebURL && item.RequestedBy == video.RequestedBy {
+			q.pending[channelID] = append(pending[:idx:idx], pending[idx+1:]...)
+			break
+		}
+	}
+	if len(q.pending[channelID]) == 0 {
+		delete(q.pending, channelID)
+	}
+}
+
+// For tracks the bot queues itself, so it skips the limit and duplicate checks Add does. The tracks must
+// already be pending, they're downloaded one at a time and queued as each is ready. Returns how many failed.
+func (q *Queue) downloadPending(discord *discordgo.Session, guildID, channelID string, tracks []VideoInfo) int {
+	failed := 0
+	for _, track := range tracks {
+		path, err := YoutubeDownloadAudio(track.WebURL, track.Title)
+		if err != nil {
+			logWarnf("Failed to download %s for guild %s: %v", track.Title, guildID, err)
+			q.finishPending(channelID, track)
+			failed++
+			continue
+		}
+
+		q.Lock()
+		q.queues[channelID] = append(q.queues[channelID], track)
+		if q.requestedBy[channelID] == nil {
+			q.requestedBy[channelID] = make(map[string]struct{})
+		}
+		q.requestedBy[channelID][track.RequestedBy] = struct{}{}
+		q.downloadedFiles[track.Title] = path
+		q.Unlock()
+		q.finishPending(channelID, track)
+
+		go StartPlaybackIfNotActive(discord, guildID, channelID)
+	}
+	return failed
+}
+
+func (q *Queue) FileInUse(path string) bool {
+	q.Lock()
+	defer q.Unlock()
+	inUse := func(video VideoInfo) bool {
+		return video.Title != "" && q.downloadedFiles[video.Title] == path
+	}
+	for _, video := range q.currentlyPlaying {
+		if inUse(video) {
+			return true
+		}
+	}
+	for _, videos := range q.queues {
+		for _, video := range videos {
+			if inUse(video) {
+				return true
+			}
+		}
+	}
+	for _, point := range q.resumePoints {
+		if inUse(point.Video) {
+			return true
+		}
+	}
+	return false
 }
 
 func (q *Queue) Get(channelID string) []VideoInfo {
@@ -132,6 +257,7 @@ func (q *Queue) Clear(channelID string) {
 	q.Lock()
 	defer q.Unlock()
 	delete(q.queues, channelID)
+	delete(q.requestedBy, channelID)
 }
 
 func (q *Queue) GetDownloadedFile(videoTitle string) (string, bool) {
@@ -200,6 +326,13 @@ func (q *Queue) GetLastActivity(guildID string) time.Time {
 	return q.lastActivity[guildID]
 }
 
+// The text channel the guild last queued something from
+func (q *Queue) GetTextChannel(guildID string) string {
+	q.Lock()
+	defer q.Unlock()
+	return q.textChannels[guildID]
+}
+
 func (q *Queue) IsShuffleEnabled(channelID string) bool {
 	q.Lock()
 	defer q.Unlock()
@@ -243,6 +376,19 @@ func (q *Queue) RemoveByTitle(channelID, title string) {
 	q.queues[channelID] = newQueue
 }
 
+func (q *Queue) RemoveAt(channelID string, index int) (VideoInfo, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	queue := q.queues[channelID]
+	if index < 0 || index >= len(queue) {
+		return VideoInfo{}, false
+	}
+	removed := queue[index]
+	q.queues[channelID] = append(queue[:index:index], queue[index+1:]...)
+	return removed, true
+}
+
 func (q *Queue) GetCurrentlyPlaying(guildID string) (VideoInfo, bool) {
 	q.Lock()
 	defer q.Unlock()
@@ -256,43 +402,255 @@ func (q *Queue) SetCurrentlyPlaying(guildID string, video VideoInfo) {
 	q.currentlyPlaying[guildID] = video
 }
 
+func (q *Queue) IsPaused(guildID string) bool {
+	q.Lock()
+	defer q.Unlock()
+	return q.paused[guildID]
+}
+
+func (q *Queue) SetPaused(guildID string, paused bool) {
+	q.Lock()
+	defer q.Unlock()
+	q.paused[guildID] = paused
+	delete(q.autoPaused, guildID)
+}
+
+func (q *Queue) IsLoopEnabled(guildID string) bool {
+	q.Lock()
+	defer q.Unlock()
+	return q.loopEnabled[guildID]
+}
+
+func (q *Queue) SetLoop(guildID string, enabled bool) {
+	q.Lock()
+	defer q.Unlock()
+	q.loopEnabled[guildID] = enabled
+}
+
+func (q *Queue) GetVolume(guildID string) int {
+	q.Lock()
+	defer q.Unlock()
+	if volume, ok := q.volume[guildID]; ok {
+		return volume
+	}
+	return GlobalSettings.Get(guildID).DefaultVolume
+}
+
+func (q *Queue) SetVolume(guildID string, volume int) int {
+	q.Lock()
+	defer q.Unlock()
+	volume = max(minVolume, min(maxVolume, volume))
+	q.volume[guildID] = volume
+	return volume
+}
+
+func (q *Queue) GetPosition(guildID string) time.Duration {
+	q.Lock()
+	defer q.Unlock()
+	return q.position[guildID]
+}
+
+func (q *Queue) SetPosition(guildID string, position time.Duration) {
+	q.Lock()
+	defer q.Unlock()
+	q.position[guildID] = position
+}
+
+func (q *Queue) GetNowPlayingPanel(guildID string) (*discordgo.Message, bool) {
+	q.Lock()
+	defer q.Unlock()
+	msg, ok := q.nowPlayingPanels[guildID]
+	return msg, ok
+}
+
+func (q *Queue) SetNowPlayingPanel(guildID string, msg *discordgo.Message) {
+	q.Lock()
+	defer q.Unlock()
+	if msg == nil {
+		delete(q.nowPlayingPanels, guildID)
+		return
+	}
+	q.nowPlayingPanels[guildID] = msg
+}
+
+const queuePageSize = 10
+
+func HandleQueueCommand(discord *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		HandleGetQueueCommand(discord, i)
+		return
+	}
+	sub := options[0]
+
+	switch sub.Name {
+	case "show":
+		HandleGetQueueCommand(discord, i)
+	case "export":
+		format := "json"
+		for _, option := range sub.Options {
+			if option.Name == "format" {
+				format = option.StringValue()
+			}
+		}
+		HandleQueueExport(discord, i, format)
+	case "import":
+		var attachmentID string
+		for _, option := range sub.Options {
+			if option.Name == "file" {
+				attachmentID, _ = option.Value.(string)
+			}
+		}
+		HandleQueueImport(discord, i, attachmentID)
+	}
+}
+
 func HandleGetQueueCommand(discord *discordgo.Session, i *discordgo.InteractionCreate) {
-	channelID := i.ChannelID
+	embed, components := buildQueueMessage(i.GuildID, i.ChannelID, GetUserID(i), 0)
+
+	discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+}
+
+func HandleQueuePage(discord *discordgo.Session, i *discordgo.InteractionCreate) {
+	page, err := strconv.Atoi(strings.TrimPrefix(i.MessageComponentData().CustomID, "queue_page:"))
+	if err != nil {
+		page = 0
+	}
+
+	embed, components := buildQueueMessage(i.GuildID, i.ChannelID, GetUserID(i), page)
+
+	err = discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if err != nil {
+		logWarnf("Failed to change queue page: %v", err)
+	}
+}
+
+func buildQueueMessage(guildID, channelID, viewerID string, page int) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
 	queue := GlobalQueue.Get(channelID)
+	shuffle := GlobalQueue.IsShuffleEnabled(channelID)
+
+	embed := &discordgo.MessageEmbed{
+		Title: "🎵 Current Queue",
+		Color: 0x1DB954,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Try /shuffle, /skip, /stop & more. Use /help to see all commands",
+		},
+	}
+
+	// Everything queued has to wait for whatever is left of the current track
+	var untilNext time.Duration
+	var builder strings.Builder
+	if current, ok := GlobalQueue.GetCurrentlyPlaying(guildID); ok && current.Title != "" {
+		untilNext = max(0, time.Duration(current.Duration)*time.Second-GlobalQueue.GetPosition(guildID))
+		fmt.Fprintf(&builder, "**Now Playing:** [%s](%s) • %s left\n\n", current.Title, current.WebURL, fmtDuration(untilNext))
+	}
 
 	if len(queue) == 0 {
-		discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Embeds: []*discordgo.MessageEmbed{
-					{
-						Title:       "🎵 Current Queue",
-						Description: "The queue is currently empty.",
-						Color:       0x1DB954,
-						Footer: &discordgo.MessageEmbedFooter{
-							Text: "Try /shuffle, /skip, /stop & more. Use /help to see all commands",
-						},
-					},
-				},
+		builder.WriteString("The queue is currently empty.")
+		embed.Description = builder.String()
+		return embed, nil
+	}
+
+	pageCount := (len(queue) + queuePageSize - 1) / queuePageSize
+	page = max(0, min(page, pageCount-1))
+	start := page * queuePageSize
+	end := min(start+queuePageSize, len(queue))
+
+	var total time.Duration
+	etas := make([]time.Duration, len(queue))
+	for idx, video := range queue {
+		etas[idx] = untilNext + total
+		total += time.Duration(video.Duration) * time.Second
+	}
+
+	for idx := start; idx < end; idx++ {
+		video := queue[idx]
+		line := fmt.Sprintf("**%d.** [%s](%s) (%s)\nRequested By: <@%s>", idx+1, video.Title, video.WebURL, fmtDuration(time.Duration(video.Duration)*time.Second), video.RequestedBy)
+		if !shuffle {
+			line += fmt.Sprintf(" • plays in %s", fmtDuration(etas[idx]))
+		}
+		if video.RequestedBy == viewerID {
+			line = "⭐ " + line
+		}
+		builder.WriteString(line + "\n\n")
+	}
+	if shuffle {
+		builder.WriteString("🔀 Shuffle is on, so tracks will play in a random order.")
+	}
+
+	embed.Description = truncateDescription(builder.String())
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Tracks", Value: strconv.Itoa(len(queue)), Inline: true},
+		{Name: "Total Duration", Value: fmtDuration(total), Inline: true},
+		{Name: "Page", Value: fmt.Sprintf("%d of %d", page+1, pageCount), Inline: true},
+	}
+	embed.Footer.Text = "⭐ marks your requests • " + embed.Footer.Text
+
+	if pageCount == 1 {
+		return embed, nil
+	}
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "◀ Previous",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("queue_page:%d", page-1),
+				Disabled: page == 0,
 			},
-		})
+			discordgo.Button{
+				Label:    "Next ▶",
+				Style:    discordgo.SecondaryButton,
+				CustomID: fmt.Sprintf("queue_page:%d", page+1),
+				Disabled: page >= pageCount-1,
+			},
+		}},
+	}
+	return embed, components
+}
+
+func HandleRemoveCommand(discord *discordgo.Session, i *discordgo.InteractionCreate) {
+	channelID := i.ChannelID
+	position := int(i.ApplicationCommandData().Options[0].IntValue())
+
+	queue := GlobalQueue.Get(channelID)
+	if position < 1 || position > len(queue) {
+		respondEphemeral(discord, i, fmt.Sprintf("❌ There's no track at position %d. Use /queue to see what's queued.", position))
 		return
 	}
 
-	var builder strings.Builder
-	for idx, video := range queue {
-		builder.WriteString(fmt.Sprintf(
-			"**%d.** [%s](%s)\nRequested By: <@%s>\n\n",
-			idx+1, video.Title, video.WebURL, video.RequestedBy,
-		))
+	// Only the requester or a DJ can take a track back out of the queue
+	target := queue[position-1]
+	if target.RequestedBy != GetUserID(i) && !isDJ(i) {
+		respondEphemeral(discord, i, "🔒 Only the person who requested that track or a DJ can remove it.")
+		return
+	}
+
+	removed, ok := GlobalQueue.RemoveAt(channelID, position-1)
+	if !ok || removed.WebURL != target.WebURL {
+		respondEphemeral(discord, i, "❌ The queue changed while removing that track. Please check /queue and try again.")
+		return
 	}
 
 	embed := &discordgo.MessageEmbed{
-		Title:       "🎵 Current Queue",
-		Description: builder.String(),
+		Title:       "🗑️ Removed from Queue",
+		Description: fmt.Sprintf("[%s](%s)", removed.Title, removed.WebURL),
 		Color:       0x1DB954,
-		Footer: &discordgo.MessageEmbedFooter{
-			Text: "Try /shuffle, /skip, /stop & more. Use /help to see all commands",
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Requested By", Value: fmt.Sprintf("<@%s>", removed.RequestedBy), Inline: true},
+			{Name: "Removed By", Value: fmt.Sprintf("<@%s>", GetUserID(i)), Inline: true},
 		},
 	}
 
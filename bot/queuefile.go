@@ -0,0 +1,365 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	queueFileVersion    = 1
+	maxQueueFileSize    = 256 << 10
+	maxQueueFileEntries = 100
+	queueFileTimeout    = 10 * time.Second
+	queueImportWorkers  = 4
+	// Leaves most of the interaction's 15 minutes for queueing and the reply
+	queueImportTimeout = 5 * time.Minute
+)
+
+type queueFile struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exported_at"`
+	Tracks     []queueFileEntry `json:"tracks"`
+}
+
+type queueFileEntry struct {
+	Title       string  `json:"title"`
+	URL         string  `json:"url"`
+	Duration    float64 `json:"duration"`
+	RequestedBy string  `json:"requested_by,omitempty"`
+}
+
+func encodeQueueJSON(tracks []VideoInfo) ([]byte, error) {
+	file := queueFile{Version: queueFileVersion, ExportedAt: time.Now().UTC()}
+	for _, track := range tracks {
+		file.Tracks = append(file.Tracks, queueFileEntry{
+			Title:       track.Title,
+			URL:         track.WebURL,
+			Duration:    track.Duration,
+			RequestedBy: track.RequestedBy,
+		})
+	}
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// Requesters go in an EXTINF attribute, players that don't know it just ignore it
+func encodeQueueM3U(tracks []VideoInfo) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	for _, track := range tracks {
+		title := strings.ReplaceAll(track.Title, "\n", " ")
+		if track.RequestedBy != "" {
+			fmt.Fprintf(&buf, "#EXTINF:%d requested-by=\"%s\",%s\n", int(track.Duration), track.RequestedBy, title)
+		} else {
+			fmt.Fprintf(&buf, "#EXTINF:%d,%s\n", int(track.Duration), title)
+		}
+		buf.WriteString(track.WebURL + "\n")
+	}
+	return buf.Bytes()
+}
+
+func decodeQueueFile(filename string, data []byte) ([]queueFileEntry, error) {
+	trimmed := bytes.TrimSpace(data)
+	lower := strings.ToLower(filename)
+	if strings.HasSuffix(lower, ".m3u") || strings.HasSuffix(lower, ".m3u8") || bytes.HasPrefix(trimmed, []byte("#EXTM3U")) {
+		return decodeQueueM3U(trimmed), nil
+	}
+
+	var file queueFile
+	if err := json.Unmarshal(trimmed, &file); err != nil {
+		return nil, fmt.Errorf("not a JSON or M3U queue file: %w", err)
+	}
+	if file.Version > queueFileVersion {
+		return nil, fmt.Errorf("queue file version %d is newer than this bot understands", file.Version)
+	}
+	return file.Tracks, nil
+}
+
+func decodeQueueM3U(data []byte) []queueFileEntry {
+	var entries []queueFileEntry
+	var pending queueFileEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			pending = queueFileEntry{}
+			info, title, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			pending.Title = title
+			fields := strings.Fields(info)
+			if len(fields) > 0 {
+				if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil && seconds > 0 {
+					pending.Duration = seconds
+				}
+			}
+			for _, field := range fields[1:] {
+				if value, ok := strings.CutPrefix(field, "requested-by="); ok {
+					pending.RequestedBy = strings.Trim(value, `"`)
+				}
+			}
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			pending.URL = line
+			entries = append(entries, pending)
+			pending = queueFileEntry{}
+		}
+	}
+	return entries
+}
+
+func HandleQueueExport(discord *discordgo.Session, i *discordgo.InteractionCreate, format string) {
+	tracks := GlobalQueue.Get(i.ChannelID)
+	if len(tracks) == 0 {
+		respondEphemeral(discord, i, "❌ The queue is empty, there's nothing to export.")
+		return
+	}
+
+	var data []byte
+	var filename, contentType string
+	switch format {
+	case "m3u":
+		data = encodeQueueM3U(tracks)
+		filename, contentType = "queue.m3u", "audio/x-mpegurl"
+	default:
+		var err error
+		data, err = encodeQueueJSON(tracks)
+		if err != nil {
+			logWarnf("Failed to export queue in guild %s: %v", i.GuildID, err)
+			respondEphemeral(discord, i, "❌ Couldn't export the queue, please try again.")
+			return
+		}
+		filename, contentType = "queue.json", "application/json"
+	}
+
+	err := discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "📤 Queue Exported",
+					Description: fmt.Sprintf("%d tracks. Load them again with `/queue import`.", len(tracks)),
+					Color:       0x1DB954,
+				},
+			},
+			Files: []*discordgo.File{
+				{Name: filename, ContentType: contentType, Reader: bytes.NewReader(data)},
+			},
+		},
+	})
+	if err != nil {
+		logWarnf("Failed to send queue export in guild %s: %v", i.GuildID, err)
+	}
+}
+
+func HandleQueueImport(discord *discordgo.Session, i *discordgo.InteractionCreate, attachmentID string) {
+	data := i.ApplicationCommandData()
+	if data.Resolved == nil || data.Resolved.Attachments[attachmentID] == nil {
+		respondEphemeral(discord, i, "❌ Please attach a queue file exported with `/queue export`.")
+		return
+	}
+	attachment := data.Resolved.Attachments[attachmentID]
+	if attachment.Size > maxQueueFileSize {
+		respondEphemeral(discord, i, fmt.Sprintf("❌ Queue files can be at most %d KB.", maxQueueFileSize>>10))
+		return
+	}
+	if !requireSameVoiceChannel(discord, i) {
+		return
+	}
+	userID := GetUserID(i)
+	if findUserVoiceChannel(discord, i.GuildID, userID) == "" && !GlobalQueue.IsInVoiceChannel(i.GuildID) {
+		respondEphemeral(discord, i, "❌ You need to be in a voice channel to import a queue.")
+		return
+	}
+
+	// Every entry is looked up on YouTube, which takes far longer than Discord waits for a response
+	err := discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+	if err != nil {
+		logWarnf("Failed to defer interaction: %v", err)
+		return
+	}
+
+	go func() {
+		body, err := downloadAttachment(attachment.URL)
+		if err != nil {
+			logWarnf("Failed to download queue file in guild %s: %v", i.GuildID, err)
+			sendErrorFollowup(discord, i, "Couldn't download the attached file, please try again.")
+			return
+		}
+		entries, err := decodeQueueFile(attachment.Filename, body)
+		if err != nil {
+			sendErrorFollowup(discord, i, fmt.Sprintf("Couldn't read that file: %v", err))
+			return
+		}
+		if len(entries) == 0 {
+			sendErrorFollowup(discord, i, "That file doesn't contain any tracks.")
+			return
+		}
+
+		var failed []string
+		if len(entries) > maxQueueFileEntries {
+			failed = append(failed, fmt.Sprintf("%d entries past the first %d were skipped", len(entries)-maxQueueFileEntries, maxQueueFileEntries))
+			entries = entries[:maxQueueFileEntries]
+		}
+
+		// Only a DJ can credit tracks to other people, anyone else could use it to get around the per-person limit
+		keepRequesters := isDJ(i)
+		requester := func(entry queueFileEntry) string {
+			if keepRequesters && entry.RequestedBy != "" {
+				return entry.RequestedBy
+			}
+			return userID
+		}
+
+		// Entries the limits would turn away anyway aren't worth a lookup
+		maxTrackLength := GlobalSettings.Get(i.GuildID).MaxTrackLength
+		room := GlobalQueue.room(i.GuildID, i.ChannelID)
+		var wanted []int
+		for idx, entry := range entries {
+			switch {
+			case !isYouTubeLink(entry.URL):
+				failed = append(failed, fmt.Sprintf("#%d %s: not a YouTube link", idx+1, entry.name()))
+			case exceedsMaxLength(VideoInfo{Duration: entry.Duration}, maxTrackLength):
+				failed = append(failed, fmt.Sprintf("#%d %s: longer than this server's limit of %s", idx+1, entry.name(), fmtLimitMinutes(maxTrackLength)))
+			case !room.take(requester(entry)):
+				failed = append(failed, fmt.Sprintf("#%d %s: over this server's queue limits", idx+1, entry.name()))
+			default:
+				wanted = append(wanted, idx)
+			}
+		}
+
+		added := 0
+		var duplicates []*DuplicateTrackError
+		for n, lookup := range lookupQueueEntries(entries, wanted) {
+			idx := wanted[n]
+			entry := entries[idx]
+			if lookup.err != nil {
+				reason := "video unavailable"
+				if errors.Is(lookup.err, context.DeadlineExceeded) {
+					reason = "skipped, the import took too long"
+				}
+				logWarnf("Failed to get video info for imported entry %s: %v", entry.URL, lookup.err)
+				failed = append(failed, fmt.Sprintf("#%d %s: %s", idx+1, entry.name(), reason))
+				continue
+			}
+			err := GlobalQueue.AddFor(discord, i.Interaction, i.GuildID, i.ChannelID, userID, requester(entry), lookup.video)
+			if err != nil {
+				var dup *DuplicateTrackError
+				if errors.As(err, &dup) && dup.Policy == DuplicateWarn {
+					duplicates = append(duplicates, dup)
+					continue
+				}
+				failed = append(failed, fmt.Sprintf("#%d %s", idx+1, err.Error()))
+				continue
+			}
+			added++
+		}
+		defer sendDuplicatePrompt(discord, i, userID, duplicates)
+
+		var builder strings.Builder
+		fmt.Fprintf(&builder, "Queued %d of %d tracks from `%s`.\n", added, len(entries), attachment.Filename)
+		if len(failed) > 0 {
+			builder.WriteString("\n**Not added:**\n")
+			for _, reason := range failed {
+				fmt.Fprintf(&builder, "• %s\n", reason)
+			}
+		}
+
+		color := 0x1DB954
+		if added == 0 {
+			color = 0xE03C3C
+		}
+		sendEmbedFollowup(discord, i, &discordgo.MessageEmbed{
+			Title:       "📥 Queue Imported",
+			Description: truncateDescription(builder.String()),
+			Color:       color,
+			Fields: []*discordgo.MessageEmbedField{
+				{Name: "Requested By", Value: fmt.Sprintf("<@%s>", userID), Inline: true},
+			},
+			Footer: &discordgo.MessageEmbedFooter{
+				Text: "Use /queue show to view the current queue.",
+			},
+		})
+	}()
+}
+
+func (e queueFileEntry) name() string {
+	if e.Title != "" {
+		return e.Title
+	}
+	return e.URL
+}
+
+type queueEntryLookup struct {
+	video VideoInfo
+	err   error
+}
+
+// Looks up the entries at the given indexes a few at a time. Anything not looked up before
+// queueImportTimeout fails with context.DeadlineExceeded.
+func lookupQueueEntries(entries []queueFileEntry, indexes []int) []queueEntryLookup {
+	ctx, cancel := context.WithTimeout(context.Background(), queueImportTimeout)
+	defer cancel()
+
+	results := make([]queueEntryLookup, len(indexes))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range queueImportWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				if err := ctx.Err(); err != nil {
+					results[n].err = err
+					continue
+				}
+				lookupCtx, lookupCancel := context.WithTimeout(ctx, 15*time.Second)
+				results[n].video, results[n].err = YoutubeGetInfoContext(lookupCtx, sanitizeYouTubeURL(entries[indexes[n]].URL))
+				lookupCancel()
+				if results[n].err != nil && ctx.Err() != nil {
+					results[n].err = ctx.Err()
+				}
+			}
+		}()
+	}
+	for n := range indexes {
+		jobs <- n
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func downloadAttachment(url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), queueFileTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxQueueFileSize))
+}
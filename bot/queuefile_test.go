@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeQueueFile(t *testing.T) {
+	tracks := []VideoInfo{
+		{Title: "First", WebURL: "https://www.youtube.com/watch?v=aaaaaaaaaaa", Duration: 200, RequestedBy: "111"},
+		{Title: "Second, with a comma", WebURL: "https://www.youtube.com/watch?v=bbbbbbbbbbb", Duration: 95.5},
+	}
+	exported, err := encodeQueueJSON(tracks)
+	if err != nil {
+		t.Fatalf("encodeQueueJSON() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+		want     []queueFileEntry
+		wantErr  bool
+	}{
+		{
+			name:     "json export round trips",
+			filename: "queue.json",
+			data:     string(exported),
+			want: []queueFileEntry{
+				{Title: "First", URL: "https://www.youtube.com/watch?v=aaaaaaaaaaa", Duration: 200, RequestedBy: "111"},
+				{Title: "Second, with a comma", URL: "https://www.youtube.com/watch?v=bbbbbbbbbbb", Duration: 95.5},
+			},
+		},
+		{
+			name:     "m3u export round trips",
+			filename: "queue.m3u",
+			data:     string(encodeQueueM3U(tracks)),
+			want: []queueFileEntry{
+				{Title: "First", URL: "https://www.youtube.com/watch?v=aaaaaaaaaaa", Duration: 200, RequestedBy: "111"},
+				{Title: "Second, with a comma", URL: "https://www.youtube.com/watch?v=bbbbbbbbbbb", Duration: 95},
+			},
+		},
+		{
+			name:     "m3u detected by header whatever the name",
+			filename: "queue.txt",
+			data:     "#EXTM3U\n\n# a comment\nhttps://youtu.be/ccccccccccc\n#EXTINF:-1,Unknown length\nhttps://youtu.be/ddddddddddd\n",
+			want: []queueFileEntry{
+				{URL: "https://youtu.be/ccccccccccc"},
+				{Title: "Unknown length", URL: "https://youtu.be/ddddddddddd"},
+			},
+		},
+		{
+			name:     "newer version is rejected",
+			filename: "queue.json",
+			data:     `{"version": 99, "tracks": []}`,
+			wantErr:  true,
+		},
+		{
+			name:     "garbage is rejected",
+			filename: "queue.json",
+			data:     "not a queue",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeQueueFile(tt.filename, []byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeQueueFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeQueueFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Terms that usually mean a result isn't the studio version, unless the user asked for them
+var penalizedTerms = []string{
+	"live",
+	"cover",
+	"reaction",
+	"karaoke",
+	"nightcore",
+	"slowed",
+	"sped up",
+	"8 hours",
+	"10 hours",
+	"1 hour",
+}
+
+const (
+	minReasonableDuration = 45 * time.Second
+	maxReasonableDuration = 20 * time.Minute
+)
+
+func RankSearchResults(query string, videos []VideoInfo, maxTrackLength time.Duration) []VideoInfo {
+	type scored struct {
+		video VideoInfo
+		score float64
+	}
+
+	var candidates []scored
+	for _, video := range videos {
+		if exceedsMaxLength(video, maxTrackLength) {
+			continue
+		}
+		candidates = append(candidates, scored{video: video, score: scoreSearchResult(query, video)})
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].score > candidates[b].score
+	})
+
+	ranked := make([]VideoInfo, 0, len(candidates))
+	for _, c := range candidates {
+		ranked = append(ranked, c.video)
+	}
+	return ranked
+}
+
+func scoreSearchResult(query string, video VideoInfo) float64 {
+	score := titleSimilarity(query, video.Title+" "+video.uploaderName())
+
+	paddedQuery := " " + strings.Join(normalizeWords(query), " ") + " "
+	paddedTitle := " " + strings.Join(normalizeWords(video.Title), " ") + " "
+	for _, term := range penalizedTerms {
+		padded := " " + term + " "
+		if strings.Contains(paddedTitle, padded) && !strings.Contains(paddedQuery, padded) {
+			score -= 0.3
+		}
+	}
+
+	uploader := strings.ToLower(video.uploaderName())
+	if strings.HasSuffix(uploader, " - topic") || strings.Contains(uploader, "vevo") || strings.Contains(paddedTitle, " official ") {
+		score += 0.2
+	}
+
+	if video.Duration > 0 {
+		duration := time.Duration(video.Duration) * time.Second
+		if duration < minReasonableDuration || duration > maxReasonableDuration {
+			score -= 0.3
+		}
+	}
+
+	return score
+}
+
+// A limit of zero means no limit, and videos with an unknown duration are let through
+func exceedsMaxLength(video VideoInfo, maxTrackLength time.Duration) bool {
+	if maxTrackLength <= 0 || video.Duration <= 0 {
+		return false
+	}
+	return time.Duration(video.Duration)*time.Second > maxTrackLength
+}
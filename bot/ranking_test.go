@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRankSearchResults(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		videos         []VideoInfo
+		maxTrackLength time.Duration
+		want           []string
+	}{
+		{
+			name:  "studio version beats live and cover",
+			query: "radiohead creep",
+			videos: []VideoInfo{
+				{ID: "live", Title: "Radiohead - Creep (Live at Glastonbury)", Uploader: "fan", Duration: 260},
+				{ID: "cover", Title: "Creep cover", Uploader: "someone", Duration: 230},
+				{ID: "studio", Title: "Creep", Uploader: "Radiohead - Topic", Duration: 238},
+			},
+			want: []string{"studio", "live", "cover"},
+		},
+		{
+			name:  "asking for live keeps it ahead",
+			query: "radiohead creep live",
+			videos: []VideoInfo{
+				{ID: "studio", Title: "Radiohead - Creep", Uploader: "Radiohead", Duration: 238},
+				{ID: "live", Title: "Radiohead - Creep live", Uploader: "Radiohead", Duration: 260},
+			},
+			want: []string{"live", "studio"},
+		},
+		{
+			name:  "channel name from flat results counts",
+			query: "daft punk one more time",
+			videos: []VideoInfo{
+				{ID: "other", Title: "One More Time", Channel: "Someone Else", Duration: 320},
+				{ID: "artist", Title: "One More Time", Channel: "Daft Punk", Duration: 320},
+			},
+			want: []string{"artist", "other"},
+		},
+		{
+			name:  "hour long loops rank last",
+			query: "lofi beats",
+			videos: []VideoInfo{
+				{ID: "loop", Title: "lofi beats 10 hours", Uploader: "loops", Duration: 36000},
+				{ID: "track", Title: "lofi beats", Uploader: "producer", Duration: 180},
+			},
+			want: []string{"track", "loop"},
+		},
+		{
+			name:  "max track length filters, unknown durations pass",
+			query: "song",
+			videos: []VideoInfo{
+				{ID: "long", Title: "song", Duration: 7200},
+				{ID: "unknown", Title: "song"},
+				{ID: "short", Title: "song", Duration: 200},
+			},
+			maxTrackLength: time.Hour,
+			want:           []string{"unknown", "short"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, video := range RankSearchResults(tt.query, tt.videos, tt.maxTrackLength) {
+				got = append(got, video.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("RankSearchResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var errVoiceLost = errors.New("voice connection lost")
+
+const (
+	// discordgo reopens the connection by itself after a voice server change or a move, so short gaps are waited out
+	voiceReadyTimeout = 10 * time.Second
+	voiceSendTimeout  = 1 * time.Second
+
+	maxReconnectAttempts = 5
+	reconnectBaseDelay   = 2 * time.Second
+	reconnectMaxDelay    = 30 * time.Second
+)
+
+// Returns false if the guild is already reconnecting
+func (q *Queue) beginReconnect(guildID string) bool {
+	q.Lock()
+	defer q.Unlock()
+	if q.reconnecting[guildID] {
+		return false
+	}
+	q.reconnecting[guildID] = true
+	return true
+}
+
+func (q *Queue) endReconnect(guildID string) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.reconnecting, guildID)
+}
+
+func (q *Queue) IsReconnecting(guildID string) bool {
+	q.Lock()
+	defer q.Unlock()
+	return q.reconnecting[guildID]
+}
+
+// Sends one frame, riding out short drops and giving up with errVoiceLost if the connection doesn't come back.
+// The connection is looked up every time so playback follows the bot when it's moved.
+func sendOpusFrame(guildID string, opus []byte, stop <-chan bool) (bool, error) {
+	deadline := time.Now().Add(voiceReadyTimeout)
+	for time.Now().Before(deadline) {
+		vc, ok := GlobalQueue.GetVoiceConnection(guildID)
+		if !ok || vc == nil {
+			return false, errVoiceLost
+		}
+		vc.RLock()
+		ready, opusSend := vc.Ready, vc.OpusSend
+		vc.RUnlock()
+		if !ready || opusSend == nil {
+			select {
+			case <-stop:
+				return true, nil
+			case <-time.After(250 * time.Millisecond):
+			}
+			continue
+		}
+
+		select {
+		case opusSend <- opus:
+			return false, nil
+		case <-stop:
+			return true, nil
+		case <-time.After(voiceSendTimeout):
+		}
+	}
+	return false, errVoiceLost
+}
+
+// Reacts to the bot's own voice state. A disconnect nobody asked for through the bot is treated like /stop,
+// except in 24/7 mode where the bot reconnects. Being moved is fine, discordgo follows the move by itself and
+// playback switches to whichever connection it ends up with.
+func handleBotVoiceState(discord *discordgo.Session, v *discordgo.VoiceStateUpdate) {
+	guildID := v.GuildID
+	if !GlobalQueue.IsInVoiceChannel(guildID) || GlobalQueue.IsReconnecting(guildID) {
+		return
+	}
+
+	switch {
+	case v.ChannelID == "":
+		if GlobalSettings.Get(guildID).AlwaysOn {
+			logInfof("Disconnected from voice in 24/7 guild %s, reconnecting", guildID)
+			HandleVoiceLost(discord, guildID)
+			return
+		}
+		logInfof("Disconnected from voice in guild %s by someone else, stopping", guildID)
+		LeaveVoiceChannel(discord, guildID)
+		sendGuildAnnouncement(discord, guildID, &discordgo.MessageEmbed{
+			Title:       "🔇 Disconnected",
+			Description: "I was disconnected from the voice channel, so playback has stopped and the queue has been cleared.",
+			Color:       0x1DB954,
+			Footer: &discordgo.MessageEmbedFooter{
+				Text: "Use /play to bring me back",
+			},
+		})
+
+	case v.BeforeUpdate != nil && v.BeforeUpdate.ChannelID != "" && v.BeforeUpdate.ChannelID != v.ChannelID:
+		syncVoiceConnection(discord, guildID)
+		if GlobalQueue.setVoiceChannel(guildID, v.ChannelID) == v.ChannelID {
+			// The bot moved itself, e.g. with /join
+			UpdateIdleState(discord, guildID)
+			return
+		}
+		logInfof("Moved from voice channel %s to %s in guild %s", v.BeforeUpdate.ChannelID, v.ChannelID, guildID)
+		// Being dragged onto a stage drops the bot into the audience
+		if v.Suppress && isStageChannel(discord, v.ChannelID) {
+			go becomeStageSpeaker(discord, guildID, v.ChannelID)
+		}
+		sendGuildAnnouncement(discord, guildID, &discordgo.MessageEmbed{
+			Title:       "🔀 Moved",
+			Description: fmt.Sprintf("I was moved to <#%s>, playback carries on there.", v.ChannelID),
+			Color:       0x1DB954,
+		})
+		UpdateIdleState(discord, guildID)
+	}
+}
+
+// Called when the voice connection is gone for good. Running playback is stopped first, the playback loop
+// saves how far it got and starts the reconnect itself once it has finished.
+func HandleVoiceLost(discord *discordgo.Session, guildID string) {
+	if !GlobalQueue.beginReconnect(guildID) {
+		return
+	}
+	if GlobalQueue.IsPlaying(guildID) {
+		skipCurrentTrack(guildID)
+		return
+	}
+	go reconnectVoice(discord, guildID)
+}
+
+// Rejoins the last voice channel with exponential backoff and carries on where playback stopped. Once
+// every attempt has failed the bot gives up but keeps the queue, so /play picks it up again.
+func reconnectVoice(discord *discordgo.Session, guildID string) {
+	var channelID string
+	if vc, ok := GlobalQueue.GetVoiceConnection(guildID); ok && vc != nil {
+		vc.RLock()
+		channelID = vc.ChannelID
+		vc.RUnlock()
+	}
+	if settings := GlobalSettings.Get(guildID); settings.AlwaysOn && settings.AlwaysOnChannelID != "" {
+		channelID = settings.AlwaysOnChannelID
+	}
+	if channelID == "" {
+		logWarnf("No voice channel to reconnect to in guild %s", guildID)
+		GlobalQueue.SetInVoiceChannel(guildID, false)
+		GlobalQueue.endReconnect(guildID)
+		return
+	}
+
+	sendGuildAnnouncement(discord, guildID, &discordgo.MessageEmbed{
+		Title:       "🔌 Voice Connection Lost",
+		Description: fmt.Sprintf("Reconnecting to <#%s>...", channelID),
+		Color:       0xE03C3C,
+	})
+
+	delay := reconnectBaseDelay
+	for attempt := 1; attempt <= maxReconnectAttempts; attempt++ {
+		time.Sleep(delay)
+		// Told to leave while waiting, e.g. with /stop
+		if !GlobalQueue.IsInVoiceChannel(guildID) {
+			GlobalQueue.endReconnect(guildID)
+			return
+		}
+
+		if vc, ok := GlobalQueue.GetVoiceConnection(guildID); ok && vc != nil {
+			vc.Disconnect()
+		}
+		err := JoinVoiceChannel(discord, guildID, channelID)
+		if err == nil {
+			logInfof("Reconnected to voice in guild %s after %d attempts", guildID, attempt)
+			GlobalQueue.endReconnect(guildID)
+			resumeAfterReconnect(discord, guildID)
+			return
+		}
+
+		logWarnf("Reconnect attempt %d of %d failed in guild %s: %v", attempt, maxReconnectAttempts, guildID, err)
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+
+	GlobalQueue.SetInVoiceChannel(guildID, false)
+	GlobalQueue.endReconnect(guildID)
+	DisableNowPlayingPanel(discord, guildID)
+	sendGuildAnnouncement(discord, guildID, &discordgo.MessageEmbed{
+		Title:       "❌ Couldn't Reconnect",
+		Description: fmt.Sprintf("I couldn't get back into <#%s> after %d attempts. The queue has been kept, use /play to try again.", channelID, maxReconnectAttempts),
+		Color:       0xE03C3C,
+	})
+}
+
+func resumeAfterReconnect(discord *discordgo.Session, guildID string) {
+	GlobalQueue.Lock()
+	textChannelID := GlobalQueue.textChannels[guildID]
+	point, resuming := GlobalQueue.resumePoints[guildID]
+	queued := len(GlobalQueue.queues[textChannelID]) > 0
+	GlobalQueue.Unlock()
+
+	description := "Back in the voice channel."
+	if resuming {
+		description = fmt.Sprintf("Back in the voice channel, resuming [%s](%s) from %s.", point.Video.Title, point.Video.WebURL, fmtDuration(point.Position))
+	}
+	sendGuildAnnouncement(discord, guildID, &discordgo.MessageEmbed{
+		Title:       "✅ Reconnected",
+		Description: description,
+		Color:       0x1DB954,
+	})
+
+	if (resuming || queued) && textChannelID != "" {
+		go StartPlaybackIfNotActive(discord, guildID, textChannelID)
+		return
+	}
+	continueAlwaysOn(discord, guildID)
+}
+
+// Posts to the channel the guild's queue lives in, or the bot's text channel if nothing has been queued yet
+func sendGuildAnnouncement(discord *discordgo.Session, guildID string, embed *discordgo.MessageEmbed) {
+	channelID := GlobalQueue.GetTextChannel(guildID)
+	if channelID == "" {
+		channelID, _ = BotTextChannel(guildID)
+	}
+	if channelID == "" {
+		logWarnf("No text channel to announce %q in guild %s", embed.Title, guildID)
+		return
+	}
+	if _, err := discord.ChannelMessageSendEmbed(channelID, embed); err != nil {
+		logWarnf("Failed to send %q in guild %s: %v", embed.Title, guildID, err)
+	}
+}
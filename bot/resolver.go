@@ -0,0 +1,328 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxResolvedTracks = 25
+	// Covers a full album of searches while leaving plenty of the interaction's 15 minutes for the reply
+	resolveTimeout = 3 * time.Minute
+	// Anything below this is more likely a different song than a rough match
+	minMatchConfidence = 0.4
+)
+
+type TrackMetadata struct {
+	Title     string
+	Artist    string
+	Duration  float64
+	SourceURL string
+}
+
+// Swap out MetadataProviders to stub the network calls when running locally
+type MetadataProvider interface {
+	Name() string
+	CanResolve(link string) bool
+	Resolve(ctx context.Context, link string) ([]TrackMetadata, error)
+}
+
+type ResolvedTrack struct {
+	Video      VideoInfo
+	Source     TrackMetadata
+	Confidence float64
+}
+
+var MetadataProviders = []MetadataProvider{
+	&htmlMetaProvider{
+		name:        "Spotify",
+		linkRegex:   regexp.MustCompile(`^(https?://)?open\.spotify\.com/(intl-[a-z]+/)?(track|album|playlist)/[A-Za-z0-9]+`),
+		parseTrack:  parseSpotifyTrack,
+		trackPrefix: "https://open.spotify.com/track/",
+	},
+	&htmlMetaProvider{
+		name:        "Apple Music",
+		linkRegex:   regexp.MustCompile(`^(https?://)?music\.apple\.com/[a-z]{2}/(album|song|playlist)/`),
+		parseTrack:  parseAppleMusicTrack,
+		trackPrefix: "https://music.apple.com/",
+	},
+}
+
+func findMetadataProvider(link string) (MetadataProvider, bool) {
+	if !features.MusicLinks {
+		return nil, false
+	}
+	for _, provider := range MetadataProviders {
+		if provider.CanResolve(link) {
+			return provider, true
+		}
+	}
+	return nil, false
+}
+
+// Unlike findMetadataProvider this ignores the music_links feature, a link never makes a useful search
+func isMusicServiceLink(link string) bool {
+	for _, provider := range MetadataProviders {
+		if provider.CanResolve(link) {
+			return true
+		}
+	}
+	return false
+}
+
+func ResolveLink(ctx context.Context, provider MetadataProvider, link string) (resolved []ResolvedTrack, failed []TrackMetadata, err error) {
+	tracks, err := provider.Resolve(ctx, link)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s link: %w", provider.Name(), err)
+	}
+	if len(tracks) == 0 {
+		return nil, nil, fmt.Errorf("no tracks found in %s link", provider.Name())
+	}
+
+	for _, track := range tracks {
+		match, err := matchTrack(ctx, track)
+		if err != nil {
+			logWarnf("Failed to match %s - %s: %v", track.Artist, track.Title, err)
+			failed = append(failed, track)
+			continue
+		}
+		resolved = append(resolved, match)
+	}
+
+	return resolved, failed, nil
+}
+
+func matchTrack(ctx context.Context, track TrackMetadata) (ResolvedTrack, error) {
+	query := track.Title
+	if track.Artist != "" {
+		query = track.Artist + " - " + track.Title
+	}
+
+	if err := ctx.Err(); err != nil {
+		return ResolvedTrack{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	results, err := YoutubeSearchContext(ctx, query, 15)
+	if err != nil {
+		return ResolvedTrack{}, err
+	}
+	if len(results.Videos) == 0 {
+		return ResolvedTrack{}, fmt.Errorf("no YouTube results for %q", query)
+	}
+
+	best := ResolvedTrack{Source: track, Confidence: -1}
+	for _, video := range results.Videos {
+		confidence := matchConfidence(track, video)
+		if confidence > best.Confidence {
+			best.Video = video
+			best.Confidence = confidence
+		}
+	}
+	if best.Confidence < minMatchConfidence {
+		return ResolvedTrack{}, fmt.Errorf("best match %q is only %s similar", best.Video.Title, fmtConfidence(best.Confidence))
+	}
+
+	return best, nil
+}
+
+// Duration is weighted most heavily since the same song tends to show up under many different titles
+func matchConfidence(track TrackMetadata, video VideoInfo) float64 {
+	titleScore := titleSimilarity(track.Artist+" "+track.Title, video.uploaderName()+" "+video.Title)
+	if track.Duration <= 0 || video.Duration <= 0 {
+		return titleScore
+	}
+	return 0.6*durationSimilarity(track.Duration, video.Duration) + 0.4*titleScore
+}
+
+func durationSimilarity(a, b float64) float64 {
+	return math.Max(0, 1-math.Abs(a-b)/30)
+}
+
+func titleSimilarity(want, got string) float64 {
+	wantWords := normalizeWords(want)
+	if len(wantWords) == 0 {
+		return 0
+	}
+
+	gotWords := make(map[string]bool)
+	for _, word := range normalizeWords(got) {
+		gotWords[word] = true
+	}
+
+	matched := 0
+	for _, word := range wantWords {
+		if gotWords[word] {
+			matched++
+		}
+	}
+	return float64(matched) / float64(len(wantWords))
+}
+
+func normalizeWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Reads the Open Graph and music meta tags streaming services embed for link previews, so no API credentials are needed
+type htmlMetaProvider struct {
+	name        string
+	linkRegex   *regexp.Regexp
+	parseTrack  func(meta map[string][]string) TrackMetadata
+	trackPrefix string
+}
+
+func (p *htmlMetaProvider) Name() string {
+	return p.name
+}
+
+func (p *htmlMetaProvider) CanResolve(link string) bool {
+	return p.linkRegex.MatchString(link)
+}
+
+func (p *htmlMetaProvider) Resolve(ctx context.Context, link string) ([]TrackMetadata, error) {
+	meta, err := fetchMetaTags(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	// Albums and playlists list their tracks as music:song links rather than describing a single song
+	songLinks := meta["music:song"]
+	if len(songLinks) == 0 {
+		track := p.parseTrack(meta)
+		if track.Title == "" {
+			return nil, fmt.Errorf("no track metadata found")
+		}
+		track.SourceURL = link
+		return []TrackMetadata{track}, nil
+	}
+
+	if len(songLinks) > maxResolvedTracks {
+		songLinks = songLinks[:maxResolvedTracks]
+	}
+
+	var tracks []TrackMetadata
+	for _, songLink := range songLinks {
+		if !strings.HasPrefix(songLink, p.trackPrefix) {
+			continue
+		}
+		songMeta, err := fetchMetaTags(ctx, songLink)
+		if err != nil {
+			logWarnf("Failed to fetch %s track %s: %v", p.name, songLink, err)
+			continue
+		}
+		track := p.parseTrack(songMeta)
+		if track.Title == "" {
+			continue
+		}
+		track.SourceURL = songLink
+		tracks = append(tracks, track)
+	}
+
+	return tracks, nil
+}
+
+var (
+	metaPropertyFirstRegex = regexp.MustCompile(`<meta\s+(?:property|name)="([^"]+)"\s+content="([^"]*)"`)
+	metaContentFirstRegex  = regexp.MustCompile(`<meta\s+content="([^"]*)"\s+(?:property|name)="([^"]+)"`)
+)
+
+func fetchMetaTags(ctx context.Context, link string) (map[string][]string, error) {
+	if !strings.HasPrefix(link, "http") {
+		link = "https://" + link
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; discord-music-bot)")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	meta := make(map[string][]string)
+	for _, m := range metaPropertyFirstRegex.FindAllStringSubmatch(string(body), -1) {
+		meta[m[1]] = append(meta[m[1]], html.UnescapeString(m[2]))
+	}
+	for _, m := range metaContentFirstRegex.FindAllStringSubmatch(string(body), -1) {
+		meta[m[2]] = append(meta[m[2]], html.UnescapeString(m[1]))
+	}
+	return meta, nil
+}
+
+func firstMeta(meta map[string][]string, key string) string {
+	if values := meta[key]; len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+	return ""
+}
+
+// Spotify track pages describe themselves as "Artist · Album · Song · Year" and give the length in seconds
+func parseSpotifyTrack(meta map[string][]string) TrackMetadata {
+	track := TrackMetadata{Title: firstMeta(meta, "og:title")}
+
+	if artist := firstMeta(meta, "music:musician_description"); artist != "" {
+		track.Artist = artist
+	} else if desc := firstMeta(meta, "og:description"); desc != "" {
+		track.Artist = strings.TrimSpace(strings.Split(desc, "·")[0])
+	}
+
+	if seconds, err := strconv.ParseFloat(firstMeta(meta, "music:duration"), 64); err == nil {
+		track.Duration = seconds
+	}
+	return track
+}
+
+var isoDurationRegex = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+
+// Apple Music titles read "Song by Artist on Apple Music" and durations may be ISO 8601 or plain seconds
+func parseAppleMusicTrack(meta map[string][]string) TrackMetadata {
+	title := strings.TrimSpace(strings.TrimPrefix(firstMeta(meta, "og:title"), "‎"))
+	title = strings.TrimSuffix(title, " on Apple Music")
+
+	track := TrackMetadata{Title: title}
+	if idx := strings.LastIndex(title, " by "); idx > 0 {
+		track.Title = title[:idx]
+		track.Artist = title[idx+len(" by "):]
+	}
+
+	raw := firstMeta(meta, "music:song:duration")
+	if raw == "" {
+		raw = firstMeta(meta, "music:duration")
+	}
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+		track.Duration = seconds
+	} else if m := isoDurationRegex.FindStringSubmatch(raw); m != nil {
+		hours, _ := strconv.Atoi(m[1])
+		minutes, _ := strconv.Atoi(m[2])
+		secs, _ := strconv.Atoi(m[3])
+		track.Duration = float64(hours*3600 + minutes*60 + secs)
+	}
+	return track
+}
@@ -0,0 +1,294 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	sessionBucket       = "sessions"
+	sessionSaveInterval = 10 * time.Second
+	// Nobody wants a queue from last week to start blasting out of nowhere
+	maxSessionAge = 24 * time.Hour
+)
+
+type savedSession struct {
+	GuildID        string        `json:"guild_id"`
+	TextChannelID  string        `json:"text_channel_id"`
+	VoiceChannelID string        `json:"voice_channel_id"`
+	Current        *VideoInfo    `json:"current,omitempty"`
+	Position       time.Duration `json:"position"`
+	Queue          []VideoInfo   `json:"queue"`
+	Shuffle        bool          `json:"shuffle"`
+	Loop           bool          `json:"loop"`
+	Volume         int           `json:"volume"`
+	SavedAt        time.Time     `json:"saved_at"`
+}
+
+type resumePoint struct {
+	Video    VideoInfo
+	Position time.Duration
+}
+
+func (q *Queue) SetResumePoint(guildID string, point resumePoint) {
+	q.Lock()
+	defer q.Unlock()
+	q.resumePoints[guildID] = point
+}
+
+func (q *Queue) TakeResumePoint(guildID string) (resumePoint, bool) {
+	q.Lock()
+	defer q.Unlock()
+	point, ok := q.resumePoints[guildID]
+	delete(q.resumePoints, guildID)
+	return point, ok
+}
+
+// Only guilds that have queued something since startup are included, so a saved session that is still
+// waiting to be resumed isn't thrown away. A nil session means the guild has nothing worth saving.
+func (q *Queue) snapshotSessions() map[string]*savedSession {
+	q.Lock()
+	defer q.Unlock()
+
+	sessions := make(map[string]*savedSession)
+	for guildID, textChannelID := range q.textChannels {
+		session := &savedSession{
+			GuildID:       guildID,
+			TextChannelID: textChannelID,
+			Queue:         append([]VideoInfo(nil), q.queues[textChannelID]...),
+			Shuffle:       q.shuffleMode[textChannelID],
+			Loop:          q.loopEnabled[guildID],
+			Volume:        GlobalSettings.Get(guildID).DefaultVolume,
+			SavedAt:       time.Now(),
+		}
+		if volume, ok := q.volume[guildID]; ok {
+			session.Volume = volume
+		}
+		if vc := q.voiceConnections[guildID]; vc != nil && q.inVoiceChannel[guildID] {
+			session.VoiceChannelID = vc.ChannelID
+		}
+		if current := q.currentlyPlaying[guildID]; current.WebURL != "" && q.playing[guildID] {
+			session.Current = &current
+			session.Position = q.position[guildID]
+		}
+
+		if session.VoiceChannelID == "" || (session.Current == nil && len(session.Queue) == 0) {
+			sessions[guildID] = nil
+			continue
+		}
+		sessions[guildID] = session
+	}
+	return sessions
+}
+
+func SaveSessions() {
+	for guildID, session := range GlobalQueue.snapshotSessions() {
+		var err error
+		if session == nil {
+			err = GlobalStore.Delete(sessionBucket, guildID)
+		} else {
+			err = GlobalStore.Put(sessionBucket, guildID, session)
+		}
+		if err != nil {
+			logErrorf("Failed to save session for guild %s: %v", guildID, err)
+		}
+	}
+}
+
+func StartSessionSaver(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			SaveSessions()
+		}
+	}()
+}
+
+// Called once the bot is ready, resumes saved sessions straight away or asks first depending on the guild's setting
+func RestoreSessions(discord *discordgo.Session) {
+	var sessions []savedSession
+	err := GlobalStore.ForEach(sessionBucket, "", func(key string, data []byte) error {
+		var session savedSession
+		if err := json.Unmarshal(data, &session); err != nil {
+			logWarnf("Skipping unreadable session %s: %v", key, err)
+			return nil
+		}
+		sessions = append(sessions, session)
+		return nil
+	})
+	if err != nil {
+		logErrorf("Failed to load saved sessions: %v", err)
+		return
+	}
+
+	for _, session := range sessions {
+		if time.Since(session.SavedAt) > maxSessionAge {
+			logInfof("Discarding stale session for guild %s saved at %s", session.GuildID, session.SavedAt)
+			GlobalStore.Delete(sessionBucket, session.GuildID)
+			continue
+		}
+
+		if GlobalSettings.Get(session.GuildID).AutoResume {
+			if err := ResumeSession(discord, session); err != nil {
+				ErrorChan <- GuildError{GuildID: session.GuildID, Err: fmt.Errorf("couldn't resume the previous session: %v", err)}
+				continue
+			}
+			_, err := discord.ChannelMessageSendEmbed(session.TextChannelID, &discordgo.MessageEmbed{
+				Title:       "▶️ Session Resumed",
+				Description: describeSession(session),
+				Color:       0x1DB954,
+			})
+			if err != nil {
+				logWarnf("Failed to announce resumed session in guild %s: %v", session.GuildID, err)
+			}
+			continue
+		}
+
+		_, err := discord.ChannelMessageSendComplex(session.TextChannelID, &discordgo.MessageSend{
+			Embeds: []*discordgo.MessageEmbed{
+				{
+					Title:       "⏯️ Resume Previous Session?",
+					Description: describeSession(session),
+					Color:       0x1DB954,
+					Footer: &discordgo.MessageEmbedFooter{
+						Text: "I was restarted while playing. Admins can resume automatically with /settings auto_resume.",
+					},
+				},
+			},
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+					discordgo.Button{Label: "Resume", Style: discordgo.SuccessButton, CustomID: "session_resume"},
+					discordgo.Button{Label: "Discard", Style: discordgo.SecondaryButton, CustomID: "session_discard"},
+				}},
+			},
+		})
+		if err != nil {
+			logWarnf("Failed to offer session resume in guild %s: %v", session.GuildID, err)
+		}
+	}
+}
+
+func describeSession(session savedSession) string {
+	description := fmt.Sprintf("%d tracks queued in <#%s>.", len(session.Queue), session.VoiceChannelID)
+	if session.Current != nil {
+		description = fmt.Sprintf("[%s](%s) at %s, with %s", session.Current.Title, session.Current.WebURL, fmtDuration(session.Position), description)
+	}
+	return description
+}
+
+// Rejoins the saved voice channel and downloads the tracks again in the background, playing the
+// interrupted track from where it stopped as soon as it's ready
+func ResumeSession(discord *discordgo.Session, session savedSession) error {
+	if err := JoinVoiceChannel(discord, session.GuildID, session.VoiceChannelID); err != nil {
+		return err
+	}
+
+	GlobalQueue.Lock()
+	GlobalQueue.textChannels[session.GuildID] = session.TextChannelID
+	GlobalQueue.shuffleMode[session.TextChannelID] = session.Shuffle
+	GlobalQueue.loopEnabled[session.GuildID] = session.Loop
+	GlobalQueue.pending[session.TextChannelID] = append(GlobalQueue.pending[session.TextChannelID], session.Queue...)
+	GlobalQueue.Unlock()
+	GlobalQueue.SetVolume(session.GuildID, session.Volume)
+
+	go func() {
+		if current := session.Current; current != nil {
+			path, err := YoutubeDownloadAudio(current.WebURL, current.Title)
+			if err != nil {
+				logWarnf("Failed to download %s to resume guild %s: %v", current.Title, session.GuildID, err)
+			} else {
+				GlobalQueue.Lock()
+				GlobalQueue.downloadedFiles[current.Title] = path
+				GlobalQueue.Unlock()
+				GlobalQueue.SetResumePoint(session.GuildID, resumePoint{Video: *current, Position: session.Position})
+				go StartPlaybackIfNotActive(discord, session.GuildID, session.TextChannelID)
+			}
+		}
+
+		failed := GlobalQueue.downloadPending(discord, session.GuildID, session.TextChannelID, session.Queue)
+		if failed > 0 {
+			ErrorChan <- GuildError{GuildID: session.GuildID, Err: fmt.Errorf("%d tracks from the previous session couldn't be downloaded again", failed)}
+		}
+	}()
+	return nil
+}
+
+func HandleSessionPromptButton(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	customID := i.MessageComponentData().CustomID
+
+	var session savedSession
+	found, err := GlobalStore.Get(sessionBucket, i.GuildID, &session)
+	if err != nil {
+		logErrorf("Failed to load saved session for guild %s: %v", i.GuildID, err)
+	}
+	if !found {
+		respondEphemeral(s, i, "❌ That session is no longer available.")
+		return
+	}
+
+	var embed *discordgo.MessageEmbed
+	switch customID {
+	case "session_resume":
+		if !requireCommandPermission(s, i, "play") {
+			return
+		}
+		if GlobalQueue.IsInVoiceChannel(i.GuildID) {
+			respondEphemeral(s, i, "❌ I'm already in a voice channel. Use /stop first if you want the old session back.")
+			return
+		}
+
+		// Joining the voice channel can take longer than Discord waits for a response
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredMessageUpdate,
+		})
+		if err != nil {
+			logWarnf("Failed to defer session resume: %v", err)
+			return
+		}
+		if err := ResumeSession(s, session); err != nil {
+			logWarnf("Failed to resume session for guild %s: %v", i.GuildID, err)
+			sendErrorFollowup(s, i, "Couldn't rejoin the voice channel, please try again.")
+			return
+		}
+		embed = &discordgo.MessageEmbed{
+			Title:       "▶️ Session Resumed",
+			Description: fmt.Sprintf("%s\nResumed by <@%s>.", describeSession(session), GetUserID(i)),
+			Color:       0x1DB954,
+		}
+
+	case "session_discard":
+		if !requireCommandPermission(s, i, "clear") {
+			return
+		}
+		if err := GlobalStore.Delete(sessionBucket, i.GuildID); err != nil {
+			logErrorf("Failed to discard session for guild %s: %v", i.GuildID, err)
+		}
+		err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredMessageUpdate,
+		})
+		if err != nil {
+			logWarnf("Failed to defer session discard: %v", err)
+			return
+		}
+		embed = &discordgo.MessageEmbed{
+			Title:       "🗑️ Session Discarded",
+			Description: fmt.Sprintf("Discarded by <@%s>. Use /play to start something new.", GetUserID(i)),
+			Color:       0x1DB954,
+		}
+
+	default:
+		return
+	}
+
+	_, err = s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+		Embeds:     &[]*discordgo.MessageEmbed{embed},
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		logWarnf("Failed to update session prompt: %v", err)
+	}
+}
@@ -0,0 +1,528 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const settingsBucket = "settings"
+
+type GuildSettings struct {
+	MaxTrackLength          time.Duration              `json:"max_track_length"`
+	VoteSkipRatio           float64                    `json:"vote_skip_ratio"`
+	DJRoleID                string                     `json:"dj_role_id,omitempty"`
+	CommandPermissions      map[string]PermissionLevel `json:"command_permissions,omitempty"`
+	RequireSameVoiceChannel bool                       `json:"require_same_voice_channel"`
+	MaxTracksPerUser        int                        `json:"max_tracks_per_user"`
+	MaxQueueLength          int                        `json:"max_queue_length"`
+	FairQueue               bool                       `json:"fair_queue"`
+	DuplicatePolicy         DuplicatePolicy            `json:"duplicate_policy"`
+	AutoResume              bool                       `json:"auto_resume"`
+	MusicChannelID          string                     `json:"music_channel_id,omitempty"`
+	DefaultVolume           int                        `json:"default_volume"`
+	IdleTimeout             time.Duration              `json:"idle_timeout"`
+	AloneTimeout            time.Duration              `json:"alone_timeout"`
+	AutoPause               bool                       `json:"auto_pause"`
+	AlwaysOn                bool                       `json:"always_on"`
+	AlwaysOnChannelID       string                     `json:"always_on_channel_id,omitempty"`
+	AlwaysOnTextChannelID   string                     `json:"always_on_text_channel_id,omitempty"`
+	FallbackPlaylist        string                     `json:"fallback_playlist,omitempty"`
+}
+
+// Overridden by ApplyConfig with the defaults from the config file
+var guildDefaults = GuildSettings{
+	MaxTrackLength:          1 * time.Hour,
+	VoteSkipRatio:           0.5,
+	RequireSameVoiceChannel: true,
+	MaxTracksPerUser:        0,
+	MaxQueueLength:          0,
+	DuplicatePolicy:         DuplicateWarn,
+	DefaultVolume:           defaultVolume,
+	IdleTimeout:             10 * time.Minute,
+	AloneTimeout:            2 * time.Minute,
+	AutoPause:               true,
+}
+
+func DefaultGuildSettings() GuildSettings {
+	settings := guildDefaults
+	settings.CommandPermissions = make(map[string]PermissionLevel)
+	return settings
+}
+
+type Settings struct {
+	sync.Mutex
+	guilds map[string]GuildSettings
+	store  *Store
+}
+
+func NewSettings() *Settings {
+	return &Settings{
+		guilds: make(map[string]GuildSettings),
+	}
+}
+
+var GlobalSettings = NewSettings()
+
+// Saved settings are decoded over the defaults, so anything added since they were saved keeps its default
+func (s *Settings) Load(store *Store) error {
+	guilds := make(map[string]GuildSettings)
+	err := store.ForEach(settingsBucket, "", func(guildID string, data []byte) error {
+		settings := DefaultGuildSettings()
+		if err := json.Unmarshal(data, &settings); err != nil {
+			logWarnf("Skipping unreadable settings for guild %s: %v", guildID, err)
+			return nil
+		}
+		guilds[guildID] = settings
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.guilds = guilds
+	s.store = store
+	return nil
+}
+
+func (s *Settings) Get(guildID string) GuildSettings {
+	s.Lock()
+	defer s.Unlock()
+	if settings, ok := s.guilds[guildID]; ok {
+		return settings
+	}
+	return DefaultGuildSettings()
+}
+
+// Guilds that have their own settings and match, guilds still on the defaults are never included
+func (s *Settings) GuildIDs(match func(GuildSettings) bool) []string {
+	s.Lock()
+	defer s.Unlock()
+	var guildIDs []string
+	for guildID, settings := range s.guilds {
+		if match(settings) {
+			guildIDs = append(guildIDs, guildID)
+		}
+	}
+	return guildIDs
+}
+
+// The change is only kept if it could be saved
+func (s *Settings) Update(guildID string, update func(*GuildSettings)) (GuildSettings, error) {
+	s.Lock()
+	defer s.Unlock()
+	settings, ok := s.guilds[guildID]
+	if !ok {
+		settings = DefaultGuildSettings()
+	}
+	// Copies handed out by Get share the map, so never modify it in place
+	settings.CommandPermissions = maps.Clone(settings.CommandPermissions)
+	if settings.CommandPermissions == nil {
+		settings.CommandPermissions = make(map[string]PermissionLevel)
+	}
+	update(&settings)
+
+	if s.store != nil {
+		if err := s.store.Put(settingsBucket, guildID, settings); err != nil {
+			return s.guilds[guildID], fmt.Errorf("failed to save settings for guild %s: %w", guildID, err)
+		}
+	}
+	s.guilds[guildID] = settings
+	return settings, nil
+}
+
+type settingDefinition struct {
+	Name        string
+	Description string
+	Get         func(GuildSettings) string
+	Set         func(*GuildSettings, string) error
+}
+
+var settingDefinitions = []settingDefinition{
+	{
+		Name:        "max_track_length",
+		Description: "Longest track that can be queued, in minutes (0 for no limit)",
+		Get: func(gs GuildSettings) string {
+			return fmtLimitMinutes(gs.MaxTrackLength)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			d, err := parseLimitMinutes(value)
+			if err != nil {
+				return err
+			}
+			gs.MaxTrackLength = d
+			return nil
+		},
+	},
+	{
+		Name:        "vote_skip_percent",
+		Description: "Percentage of listeners who must vote before a track is skipped (0 lets anyone skip instantly)",
+		Get: func(gs GuildSettings) string {
+			return fmt.Sprintf("%.0f%%", gs.VoteSkipRatio*100)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			percent, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+			if err != nil || percent < 0 || percent > 100 {
+				return fmt.Errorf("expected a percentage between 0 and 100, got %q", value)
+			}
+			gs.VoteSkipRatio = float64(percent) / 100
+			return nil
+		},
+	},
+	{
+		Name:        "require_same_voice_channel",
+		Description: "Whether playback commands can only be used from the bot's voice channel (admins are always exempt)",
+		Get: func(gs GuildSettings) string {
+			return fmtOnOff(gs.RequireSameVoiceChannel)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			enabled, err := parseOnOff(value)
+			if err != nil {
+				return err
+			}
+			gs.RequireSameVoiceChannel = enabled
+			return nil
+		},
+	},
+	{
+		Name:        "max_tracks_per_user",
+		Description: "How many tracks one person can have in the queue at once (0 for no limit)",
+		Get: func(gs GuildSettings) string {
+			return fmtLimitCount(gs.MaxTracksPerUser)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			n, err := parseLimitCount(value)
+			if err != nil {
+				return err
+			}
+			gs.MaxTracksPerUser = n
+			return nil
+		},
+	},
+	{
+		Name:        "max_queue_length",
+		Description: "How many tracks the queue can hold in total (0 for no limit)",
+		Get: func(gs GuildSettings) string {
+			return fmtLimitCount(gs.MaxQueueLength)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			n, err := parseLimitCount(value)
+			if err != nil {
+				return err
+			}
+			gs.MaxQueueLength = n
+			return nil
+		},
+	},
+	{
+		Name:        "fair_queue",
+		Description: "Whether the queue takes turns between requesters instead of playing tracks in the order they were added",
+		Get: func(gs GuildSettings) string {
+			return fmtOnOff(gs.FairQueue)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			enabled, err := parseOnOff(value)
+			if err != nil {
+				return err
+			}
+			gs.FairQueue = enabled
+			return nil
+		},
+	},
+	{
+		Name:        "duplicates",
+		Description: "What happens when a track that's queued, playing or was just played is added again: allow, warn or reject",
+		Get: func(gs GuildSettings) string {
+			return string(gs.DuplicatePolicy)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			policy, err := parseDuplicatePolicy(value)
+			if err != nil {
+				return err
+			}
+			gs.DuplicatePolicy = policy
+			return nil
+		},
+	},
+	{
+		Name:        "auto_resume",
+		Description: "Whether playback picks up again by itself after the bot restarts, instead of asking first",
+		Get: func(gs GuildSettings) string {
+			return fmtOnOff(gs.AutoResume)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			enabled, err := parseOnOff(value)
+			if err != nil {
+				return err
+			}
+			gs.AutoResume = enabled
+			return nil
+		},
+	},
+	{
+		Name:        "music_channel",
+		Description: "Text channel where I post errors and announcements, as a #mention or ID (none to pick one automatically)",
+		Get: func(gs GuildSettings) string {
+			if gs.MusicChannelID == "" {
+				return "automatic"
+			}
+			return fmt.Sprintf("<#%s>", gs.MusicChannelID)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			id, err := parseMentionID(value, "<#")
+			if err != nil {
+				return err
+			}
+			gs.MusicChannelID = id
+			return nil
+		},
+	},
+	{
+		Name:        "dj_role",
+		Description: "Role whose members count as DJs, as an @mention or ID (none to clear it)",
+		Get: func(gs GuildSettings) string {
+			if gs.DJRoleID == "" {
+				return "not set"
+			}
+			return fmt.Sprintf("<@&%s>", gs.DJRoleID)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			id, err := parseMentionID(value, "<@&")
+			if err != nil {
+				return err
+			}
+			gs.DJRoleID = id
+			return nil
+		},
+	},
+	{
+		Name:        "default_volume",
+		Description: fmt.Sprintf("Volume playback starts at, in percent (%d to %d)", minVolume, maxVolume),
+		Get: func(gs GuildSettings) string {
+			return fmt.Sprintf("%d%%", gs.DefaultVolume)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			volume, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+			if err != nil || volume < minVolume || volume > maxVolume {
+				return fmt.Errorf("expected a volume between %d and %d, got %q", minVolume, maxVolume, value)
+			}
+			gs.DefaultVolume = volume
+			return nil
+		},
+	},
+	{
+		Name:        "idle_timeout",
+		Description: "How long I stay in the voice channel with nothing playing, in minutes (0 to stay until told to leave)",
+		Get: func(gs GuildSettings) string {
+			return fmtLimitMinutes(gs.IdleTimeout)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			d, err := parseLimitMinutes(value)
+			if err != nil {
+				return err
+			}
+			gs.IdleTimeout = d
+			return nil
+		},
+	},
+	{
+		Name:        "alone_timeout",
+		Description: "How long I stay in the voice channel once everyone else has left, in minutes (0 to stay)",
+		Get: func(gs GuildSettings) string {
+			return fmtLimitMinutes(gs.AloneTimeout)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			d, err := parseLimitMinutes(value)
+			if err != nil {
+				return err
+			}
+			gs.AloneTimeout = d
+			return nil
+		},
+	},
+	{
+		Name:        "auto_pause",
+		Description: "Whether playback pauses when everyone leaves the voice channel and resumes when someone comes back",
+		Get: func(gs GuildSettings) string {
+			return fmtOnOff(gs.AutoPause)
+		},
+		Set: func(gs *GuildSettings, value string) error {
+			enabled, err := parseOnOff(value)
+			if err != nil {
+				return err
+			}
+			gs.AutoPause = enabled
+			return nil
+		},
+	},
+}
+
+func findSettingDefinition(name string) (settingDefinition, bool) {
+	for _, def := range settingDefinitions {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return settingDefinition{}, false
+}
+
+func settingChoices() []*discordgo.ApplicationCommandOptionChoice {
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, def := range settingDefinitions {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: def.Name, Value: def.Name})
+	}
+	return choices
+}
+
+func parseLimitMinutes(value string) (time.Duration, error) {
+	minutes, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("expected a whole number of minutes, got %q", value)
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+func fmtLimitMinutes(d time.Duration) string {
+	if d <= 0 {
+		return "no limit"
+	}
+	return fmt.Sprintf("%d minutes", int(d.Minutes()))
+}
+
+func parseLimitCount(value string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("expected a whole number, got %q", value)
+	}
+	return n, nil
+}
+
+func fmtLimitCount(n int) string {
+	if n <= 0 {
+		return "no limit"
+	}
+	return strconv.Itoa(n)
+}
+
+// Accepts a mention like <#123> or <@&123>, a bare ID, or none to clear the value
+func parseMentionID(value, mentionPrefix string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "none", "off", "clear":
+		return "", nil
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(value, mentionPrefix), ">")
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", fmt.Errorf("expected a mention or ID, got %q", value)
+	}
+	return id, nil
+}
+
+func parseOnOff(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "on", "true", "yes", "enabled":
+		return true, nil
+	case "off", "false", "no", "disabled":
+		return false, nil
+	}
+	return false, fmt.Errorf("expected on or off, got %q", value)
+}
+
+func fmtOnOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+func HandleSettingsCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var name, value string
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "name":
+			name = option.StringValue()
+		case "value":
+			value = option.StringValue()
+		}
+	}
+
+	if name == "" || value == "" {
+		current := GlobalSettings.Get(i.GuildID)
+		var builder strings.Builder
+		for _, def := range settingDefinitions {
+			if name != "" && def.Name != name {
+				continue
+			}
+			fmt.Fprintf(&builder, "**%s**: %s\n%s\n\n", def.Name, def.Get(current), def.Description)
+		}
+
+		embed := &discordgo.MessageEmbed{
+			Title:       "⚙️ Server Settings",
+			Description: builder.String(),
+			Color:       0x1DB954,
+			Footer: &discordgo.MessageEmbedFooter{
+				Text: "Use /settings name:<setting> value:<value> to change a setting",
+			},
+		}
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds: []*discordgo.MessageEmbed{embed},
+				Flags:  discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+
+	def, ok := findSettingDefinition(name)
+	if !ok {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("❌ Unknown setting `%s`.", name),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+
+	var setErr error
+	updated, err := GlobalSettings.Update(i.GuildID, func(gs *GuildSettings) {
+		setErr = def.Set(gs, value)
+	})
+	if setErr != nil {
+		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("❌ Invalid value for `%s`: %v", name, setErr),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+	if err != nil {
+		logErrorf("Failed to update setting %s: %v", name, err)
+		respondEphemeral(s, i, "❌ Couldn't save the setting, please try again.")
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "⚙️ Setting Updated",
+		Description: fmt.Sprintf("**%s** is now **%s**.", def.Name, def.Get(updated)),
+		Color:       0x1DB954,
+	}
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+		},
+	})
+}
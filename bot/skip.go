@@ -2,15 +2,23 @@ package bot
 
 import (
 	"fmt"
-	"log"
+	"math"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+type skipVote struct {
+	TrackURL  string
+	Voters    map[string]struct{}
+	ChannelID string
+	MessageID string
+}
+
 func HandleSkipCommand(discord *discordgo.Session, i *discordgo.InteractionCreate) {
 	guildID := i.GuildID
 	channelID := i.ChannelID
+	userID := GetUserID(i)
 
 	if !GlobalQueue.IsInVoiceChannel(guildID) {
 		embed := &discordgo.MessageEmbed{
@@ -27,7 +35,8 @@ func HandleSkipCommand(discord *discordgo.Session, i *discordgo.InteractionCreat
 		return
 	}
 
-	if !GlobalQueue.IsPlaying(guildID) {
+	current, ok := GlobalQueue.GetCurrentlyPlaying(guildID)
+	if !GlobalQueue.IsPlaying(guildID) || !ok || current.Title == "" {
 		embed := &discordgo.MessageEmbed{
 			Title:       "⏹️ Nothing Playing",
 			Description: "There's no track currently playing to skip.",
@@ -42,72 +51,267 @@ func HandleSkipCommand(discord *discordgo.Session, i *discordgo.InteractionCreat
 		return
 	}
 
-	next, ok := GlobalQueue.Peek(channelID)
-	if !ok {
-		embed := &discordgo.MessageEmbed{
-			Title:       "📭 Queue Empty",
-			Description: "No more songs left in the queue to skip to.",
-			Color:       0x1DB954,
+	ratio := GlobalSettings.Get(guildID).VoteSkipRatio
+	if current.RequestedBy == userID || isDJ(i) || ratio <= 0 {
+		GlobalQueue.Lock()
+		var voteChannelID, voteMessageID string
+		if vote, ok := GlobalQueue.skipVotes[guildID]; ok && vote.TrackURL == current.WebURL {
+			voteChannelID, voteMessageID = vote.ChannelID, vote.MessageID
 		}
+		GlobalQueue.Unlock()
+
+		skipCurrentTrack(guildID)
+		embed := buildSkippedEmbed(channelID, current, fmt.Sprintf("Skipped by <@%s>.", userID))
+
+		// Pressed on the vote message, which turns into the skipped message with its button disabled
+		if isSkipVoteButton(i) {
+			discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseUpdateMessage,
+				Data: &discordgo.InteractionResponseData{
+					Embeds:     []*discordgo.MessageEmbed{embed},
+					Components: buildSkipVoteControls(true),
+				},
+			})
+			return
+		}
+
 		discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Embeds: []*discordgo.MessageEmbed{embed},
 			},
 		})
+		// A vote that was still running is closed so nobody votes on the next track by accident
+		if voteMessageID != "" {
+			components := buildSkipVoteControls(true)
+			_, err := discord.ChannelMessageEditComplex(&discordgo.MessageEdit{
+				ID:         voteMessageID,
+				Channel:    voteChannelID,
+				Embeds:     &[]*discordgo.MessageEmbed{embed},
+				Components: &components,
+			})
+			if err != nil {
+				logWarnf("Failed to close skip vote message in guild %s: %v", guildID, err)
+			}
+		}
 		return
 	}
 
+	voteToSkip(discord, i, current, ratio)
+}
+
+func HandleSkipVoteButton(discord *discordgo.Session, i *discordgo.InteractionCreate) {
+	if !requireCommandPermission(discord, i, "skip") || !requireSameVoiceChannel(discord, i) {
+		return
+	}
+	current, ok := GlobalQueue.GetCurrentlyPlaying(i.GuildID)
+	if !GlobalQueue.IsPlaying(i.GuildID) || !ok || current.Title == "" {
+		respondEphemeral(discord, i, "⏹️ There's no track currently playing to skip.")
+		return
+	}
+	HandleSkipCommand(discord, i)
+}
+
+// The now playing panel's skip button goes through the same path as /skip and must leave the panel alone,
+// only the vote message itself is updated in place
+func isSkipVoteButton(i *discordgo.InteractionCreate) bool {
+	return i.Type == discordgo.InteractionMessageComponent && i.MessageComponentData().CustomID == "skip_vote"
+}
+
+// Tells the playback loop to move on, it handles starting the next track (or finishing up if the queue is empty)
+func skipCurrentTrack(guildID string) {
 	GlobalQueue.Lock()
 	stopChan, found := GlobalQueue.stopChans[guildID]
+	delete(GlobalQueue.skipVotes, guildID)
 	GlobalQueue.Unlock()
 
-	_, popped := GlobalQueue.Pop(channelID)
-	if !popped {
-		log.Printf("Warning: tried to pop current track in skip but queue was empty for channel %s", channelID)
+	if !found {
+		logDebugf("No active stop channel for guild %s", guildID)
+		return
+	}
+
+	select {
+	case stopChan <- true:
+		logDebugf("Skip signal sent for guild %s", guildID)
+	default:
+		logDebugf("Skip channel full or not listening for guild %s", guildID)
 	}
+}
 
-	if found {
-		select {
-		case stopChan <- true:
-			log.Printf("Skip signal sent for guild %s", guildID)
-		default:
-			log.Printf("Skip channel full or not listening for guild %s", guildID)
+func voteToSkip(discord *discordgo.Session, i *discordgo.InteractionCreate, current VideoInfo, ratio float64) {
+	guildID := i.GuildID
+	userID := GetUserID(i)
+
+	var listeners []string
+	if vc, ok := GlobalQueue.GetVoiceConnection(guildID); ok && vc != nil {
+		listeners = voiceChannelListeners(discord, guildID, vc.ChannelID)
+	}
+
+	isListener := false
+	for _, id := range listeners {
+		if id == userID {
+			isListener = true
+			break
 		}
-	} else {
-		log.Printf("No active stop channel for guild %s", guildID)
+	}
+	if !isListener {
+		respondEphemeral(discord, i, "❌ You need to be listening in my voice channel to vote to skip.")
+		return
 	}
 
-	GlobalQueue.SetPlaying(guildID, false)
+	GlobalQueue.Lock()
+	vote, ok := GlobalQueue.skipVotes[guildID]
+	if !ok || vote.TrackURL != current.WebURL {
+		vote = &skipVote{TrackURL: current.WebURL, Voters: make(map[string]struct{})}
+		GlobalQueue.skipVotes[guildID] = vote
+	}
+	_, alreadyVoted := vote.Voters[userID]
+	vote.Voters[userID] = struct{}{}
 
-	duration := time.Duration(next.Duration) * time.Second
-	embed := &discordgo.MessageEmbed{
-		Title:       "⏭️ Skipping to Next Track",
-		Description: fmt.Sprintf("[%s](%s)", next.Title, next.WebURL),
+	// Only count voters who are still in the channel
+	votes := 0
+	for _, id := range listeners {
+		if _, ok := vote.Voters[id]; ok {
+			votes++
+		}
+	}
+	required := max(1, int(math.Ceil(ratio*float64(len(listeners)))))
+	channelID, messageID := vote.ChannelID, vote.MessageID
+	GlobalQueue.Unlock()
+
+	passed := votes >= required
+	if passed {
+		skipCurrentTrack(guildID)
+	}
+
+	embed := buildSkipVoteEmbed(i.ChannelID, current, votes, required, passed)
+	components := buildSkipVoteControls(passed)
+
+	// Clicking the vote button updates the counter in place
+	if isSkipVoteButton(i) {
+		discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseUpdateMessage,
+			Data: &discordgo.InteractionResponseData{
+				Embeds:     []*discordgo.MessageEmbed{embed},
+				Components: components,
+			},
+		})
+		return
+	}
+
+	// A /skip (or the panel's skip button) after voting has started updates the existing counter rather than posting another one
+	if messageID != "" {
+		_, err := discord.ChannelMessageEditComplex(&discordgo.MessageEdit{
+			ID:         messageID,
+			Channel:    channelID,
+			Embeds:     &[]*discordgo.MessageEmbed{embed},
+			Components: &components,
+		})
+		if err == nil {
+			message := "🗳️ Your vote to skip has been counted."
+			if alreadyVoted {
+				message = "🗳️ You've already voted to skip this track."
+			}
+			if passed {
+				message = "⏭️ Your vote passed, skipping the track."
+			}
+			respondEphemeral(discord, i, message)
+			return
+		}
+		logWarnf("Failed to update skip vote message in guild %s: %v", guildID, err)
+	}
+
+	err := discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if err != nil {
+		logWarnf("Failed to send skip vote message in guild %s: %v", guildID, err)
+		return
+	}
+
+	if passed {
+		return
+	}
+	msg, err := discord.InteractionResponse(i.Interaction)
+	if err != nil {
+		logWarnf("Failed to fetch skip vote message in guild %s: %v", guildID, err)
+		return
+	}
+
+	GlobalQueue.Lock()
+	if vote, ok := GlobalQueue.skipVotes[guildID]; ok && vote.TrackURL == current.WebURL {
+		vote.ChannelID = msg.ChannelID
+		vote.MessageID = msg.ID
+	}
+	GlobalQueue.Unlock()
+}
+
+func buildSkipVoteEmbed(channelID string, current VideoInfo, votes, required int, passed bool) *discordgo.MessageEmbed {
+	if passed {
+		return buildSkippedEmbed(channelID, current, fmt.Sprintf("The vote passed with %d/%d votes.", votes, required))
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       "🗳️ Vote to Skip",
+		Description: fmt.Sprintf("[%s](%s)", current.Title, current.WebURL),
 		Color:       0x1DB954,
 		Fields: []*discordgo.MessageEmbedField{
-			{
-				Name:   "Requested By",
-				Value:  fmt.Sprintf("<@%s>", next.RequestedBy),
-				Inline: true,
-			},
-			{
-				Name:   "Duration",
-				Value:  fmtDuration(duration),
-				Inline: true,
-			},
+			{Name: "Votes", Value: fmt.Sprintf("%d/%d", votes, required), Inline: true},
+			{Name: "Requested By", Value: fmt.Sprintf("<@%s>", current.RequestedBy), Inline: true},
 		},
 		Footer: &discordgo.MessageEmbedFooter{
-			Text: "Try /play to add new songs, or /help for all commands",
+			Text: "Listeners can vote with the button below or /skip. The requester or a DJ can skip instantly.",
 		},
 	}
+}
 
-	discord.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Embeds: []*discordgo.MessageEmbed{embed},
+func buildSkipVoteControls(passed bool) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Vote to Skip",
+				Emoji:    &discordgo.ComponentEmoji{Name: "⏭️"},
+				Style:    discordgo.PrimaryButton,
+				CustomID: "skip_vote",
+				Disabled: passed,
+			},
+		}},
+	}
+}
+
+func buildSkippedEmbed(channelID string, skipped VideoInfo, reason string) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       "⏭️ Skipped",
+		Description: fmt.Sprintf("[%s](%s)\n%s", skipped.Title, skipped.WebURL, reason),
+		Color:       0x1DB954,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Try /play to add new songs, or /help for all commands",
 		},
-	})
+	}
+
+	next, ok := GlobalQueue.Peek(channelID)
+	if !ok {
+		embed.Fields = []*discordgo.MessageEmbedField{
+			{Name: "Up Next", Value: "The queue is empty, so playback will stop."},
+		}
+		return embed
+	}
+	if GlobalQueue.IsShuffleEnabled(channelID) {
+		embed.Fields = []*discordgo.MessageEmbedField{
+			{Name: "Up Next", Value: "A random pick from the queue."},
+		}
+		return embed
+	}
 
-	go StartPlaybackIfNotActive(discord, guildID, channelID)
+	duration := time.Duration(next.Duration) * time.Second
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Up Next", Value: fmt.Sprintf("[%s](%s)", next.Title, next.WebURL)},
+		{Name: "Requested By", Value: fmt.Sprintf("<@%s>", next.RequestedBy), Inline: true},
+		{Name: "Duration", Value: fmtDuration(duration), Inline: true},
+	}
+	return embed
 }
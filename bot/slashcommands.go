@@ -14,6 +14,10 @@ type SlashCommand struct {
 
 var SlashCommands map[string]SlashCommand
 
+var manageGuildPermission int64 = discordgo.PermissionManageGuild
+
+var minQueuePosition float64 = 1
+
 func init() {
 	SlashCommands = map[string]SlashCommand{
 		"help": {
@@ -57,10 +61,11 @@ func init() {
 				Description: "Enter a song name for the bot to play",
 				Options: []*discordgo.ApplicationCommandOption{
 					{
-						Type:        discordgo.ApplicationCommandOptionString,
-						Name:        "query",
-						Description: "Search term",
-						Required:    true,
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "query",
+						Description:  "Search term or link",
+						Required:     true,
+						Autocomplete: true,
 					},
 				},
 			},
@@ -69,9 +74,215 @@ func init() {
 		"queue": {
 			Command: &discordgo.ApplicationCommand{
 				Name:        "queue",
-				Description: "Get the current queue",
+				Description: "View, export or import the queue",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "show",
+						Description: "Get the current queue",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "export",
+						Description: "Download the queue as a file you can share or import later",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "format",
+								Description: "File format (defaults to JSON)",
+								Choices: []*discordgo.ApplicationCommandOptionChoice{
+									{Name: "JSON", Value: "json"},
+									{Name: "M3U", Value: "m3u"},
+								},
+							},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "import",
+						Description: "Add the tracks from an exported queue file",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionAttachment,
+								Name:        "file",
+								Description: "JSON or M3U file from /queue export",
+								Required:    true,
+							},
+						},
+					},
+				},
+			},
+			Handler: HandleQueueCommand,
+		},
+		"remove": {
+			Command: &discordgo.ApplicationCommand{
+				Name:        "remove",
+				Description: "Remove a track from the queue",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "position",
+						Description: "Position of the track in /queue",
+						Required:    true,
+						MinValue:    &minQueuePosition,
+					},
+				},
+			},
+			Handler: HandleRemoveCommand,
+		},
+		"permissions": {
+			Command: &discordgo.ApplicationCommand{
+				Name:                     "permissions",
+				Description:              "Configure the DJ role and which commands need it",
+				DefaultMemberPermissions: &manageGuildPermission,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "dj_role",
+						Description: "Set the DJ role, or leave it empty to clear it",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionRole,
+								Name:        "role",
+								Description: "Role whose members count as DJs",
+							},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "command",
+						Description: "Choose who can use a command",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "name",
+								Description: "Command name, without the slash",
+								Required:    true,
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "level",
+								Description: "Who can use it",
+								Required:    true,
+								Choices:     permissionLevelChoices(),
+							},
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "show",
+						Description: "Show the DJ role and command permissions",
+					},
+				},
+			},
+			Handler: HandlePermissionsCommand,
+		},
+		"playlist": {
+			Command: &discordgo.ApplicationCommand{
+				Name:        "playlist",
+				Description: "Save tracks to personal or server playlists and play them later",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "create",
+						Description: "Create an empty playlist",
+						Options: []*discordgo.ApplicationCommandOption{
+							playlistNameOption(false),
+							playlistScopeOption("Who the playlist belongs to (defaults to personal)"),
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "add",
+						Description: "Add the current track, the queue or a link to a playlist",
+						Options: []*discordgo.ApplicationCommandOption{
+							playlistNameOption(true),
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "link",
+								Description: "YouTube link to add instead of the current track",
+							},
+							{
+								Type:        discordgo.ApplicationCommandOptionBoolean,
+								Name:        "from_queue",
+								Description: "Add everything in the queue instead of the current track",
+							},
+							playlistScopeOption("Which playlist to use if you have both with this name"),
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "remove",
+						Description: "Remove a track from a playlist",
+						Options: []*discordgo.ApplicationCommandOption{
+							playlistNameOption(true),
+							{
+								Type:        discordgo.ApplicationCommandOptionInteger,
+								Name:        "position",
+								Description: "Position of the track in /playlist show",
+								Required:    true,
+								MinValue:    &minQueuePosition,
+							},
+							playlistScopeOption("Which playlist to use if you have both with this name"),
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "show",
+						Description: "List your playlists, or the tracks in one",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:         discordgo.ApplicationCommandOptionString,
+								Name:         "name",
+								Description:  "Playlist to show",
+								Autocomplete: true,
+							},
+							playlistScopeOption("Which playlist to use if you have both with this name"),
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "play",
+						Description: "Add every track in a playlist to the queue",
+						Options: []*discordgo.ApplicationCommandOption{
+							playlistNameOption(true),
+							playlistScopeOption("Which playlist to use if you have both with this name"),
+						},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "delete",
+						Description: "Delete a playlist",
+						Options: []*discordgo.ApplicationCommandOption{
+							playlistNameOption(true),
+							playlistScopeOption("Which playlist to use if you have both with this name"),
+						},
+					},
+				},
+			},
+			Handler: HandlePlaylistCommand,
+		},
+		"join": {
+			Command: &discordgo.ApplicationCommand{
+				Name:        "join",
+				Description: "Bring the bot into a voice channel, or move it to another one",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "Voice channel to join (defaults to the one you're in)",
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildVoice, discordgo.ChannelTypeGuildStageVoice},
+					},
+				},
 			},
-			Handler: HandleGetQueueCommand,
+			Handler: HandleJoinCommand,
+		},
+		"leave": {
+			Command: &discordgo.ApplicationCommand{
+				Name:        "leave",
+				Description: "Leave the voice channel but keep the queue for later",
+			},
+			Handler: HandleLeaveCommand,
 		},
 		"clear": {
 			Command: &discordgo.ApplicationCommand{
@@ -80,13 +291,13 @@ func init() {
 			},
 			Handler: HandleClearQueueCommand,
 		},
-		// "skip": {
-		// 	Command: &discordgo.ApplicationCommand{
-		// 		Name:        "skip",
-		// 		Description: "Skip the current song",
-		// 	},
-		// 	Handler: HandleSkipCommand,
-		// },
+		"skip": {
+			Command: &discordgo.ApplicationCommand{
+				Name:        "skip",
+				Description: "Skip the current song, or vote to skip if you didn't request it",
+			},
+			Handler: HandleSkipCommand,
+		},
 		"stop": {
 			Command: &discordgo.ApplicationCommand{
 				Name:        "stop",
@@ -94,6 +305,55 @@ func init() {
 			},
 			Handler: HandleStopCommand,
 		},
+		"settings": {
+			Command: &discordgo.ApplicationCommand{
+				Name:                     "settings",
+				Description:              "View or change this server's music settings",
+				DefaultMemberPermissions: &manageGuildPermission,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "name",
+						Description: "Setting to view or change",
+						Choices:     settingChoices(),
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "value",
+						Description: "New value for the setting",
+					},
+				},
+			},
+			Handler: HandleSettingsCommand,
+		},
+		"247": {
+			Command: &discordgo.ApplicationCommand{
+				Name:                     "247",
+				Description:              "Keep the bot in a voice channel around the clock",
+				DefaultMemberPermissions: &manageGuildPermission,
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "enabled",
+						Description: "Turn 24/7 mode on or off",
+						Required:    true,
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "Voice channel to stay in (defaults to the one you're in)",
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildVoice, discordgo.ChannelTypeGuildStageVoice},
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "playlist",
+						Description:  "Server playlist to play whenever the queue runs out (none to stop using one)",
+						Autocomplete: true,
+					},
+				},
+			},
+			Handler: HandleAlwaysOnCommand,
+		},
 		"shuffle": {
 			Command: &discordgo.ApplicationCommand{
 				Name:        "shuffle",
@@ -113,12 +373,22 @@ func init() {
 	}
 }
 
-func RegisterSlashCommands(discord *discordgo.Session) {
-	for _, guild := range discord.State.Guilds {
-		for _, cmd := range SlashCommands {
-			_, err := discord.ApplicationCommandCreate(discord.State.User.ID, guild.ID, cmd.Command)
-			CheckNilErr(err)
-		}
+func playlistNameOption(autocomplete bool) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:         discordgo.ApplicationCommandOptionString,
+		Name:         "name",
+		Description:  "Playlist name",
+		Required:     true,
+		Autocomplete: autocomplete,
+	}
+}
+
+func playlistScopeOption(description string) *discordgo.ApplicationCommandOption {
+	return &discordgo.ApplicationCommandOption{
+		Type:        discordgo.ApplicationCommandOptionString,
+		Name:        "scope",
+		Description: description,
+		Choices:     playlistScopeChoices(),
 	}
 }
 
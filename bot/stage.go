@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const maxStageTopicLength = 120
+
+// discordgo has no helper for changing the bot's own voice state, so the request body is built here
+type stageVoiceStateParams struct {
+	ChannelID               string     `json:"channel_id"`
+	Suppress                *bool      `json:"suppress,omitempty"`
+	RequestToSpeakTimestamp *time.Time `json:"request_to_speak_timestamp,omitempty"`
+}
+
+func isStageChannel(discord *discordgo.Session, channelID string) bool {
+	channel, err := discord.State.Channel(channelID)
+	if err != nil {
+		if channel, err = discord.Channel(channelID); err != nil {
+			logWarnf("Failed to look up channel %s: %v", channelID, err)
+			return false
+		}
+	}
+	return channel.Type == discordgo.ChannelTypeGuildStageVoice
+}
+
+// Joining a stage puts the bot in the audience where nobody can hear it. With Mute Members it can make
+// itself a speaker, otherwise it raises its hand and a stage moderator has to invite it up.
+func becomeStageSpeaker(discord *discordgo.Session, guildID, channelID string) {
+	perms, err := discord.State.UserChannelPermissions(discord.State.User.ID, channelID)
+	if err != nil {
+		logWarnf("Failed to check stage permissions in guild %s: %v", guildID, err)
+	}
+
+	params := stageVoiceStateParams{ChannelID: channelID}
+	canSpeak := perms&discordgo.PermissionVoiceMuteMembers != 0
+	if canSpeak {
+		suppress := false
+		params.Suppress = &suppress
+	} else {
+		now := time.Now()
+		params.RequestToSpeakTimestamp = &now
+	}
+
+	endpoint := discordgo.EndpointGuild(guildID) + "/voice-states/@me"
+	if _, err := discord.RequestWithBucketID(http.MethodPatch, endpoint, params, endpoint); err != nil {
+		logWarnf("Failed to update stage voice state in guild %s: %v", guildID, err)
+		return
+	}
+	if canSpeak {
+		logInfof("Became a speaker on stage %s in guild %s", channelID, guildID)
+		return
+	}
+
+	logInfof("Requested to speak on stage %s in guild %s", channelID, guildID)
+	sendGuildAnnouncement(discord, guildID, &discordgo.MessageEmbed{
+		Title:       "✋ Requested to Speak",
+		Description: "I'm in the stage audience, so nobody can hear me yet. A stage moderator needs to invite me to speak, or give me the Mute Members permission so I can do it myself.",
+		Color:       0x1DB954,
+	})
+}
+
+// Starts the stage with the track as its topic if it isn't live yet, otherwise just changes the topic
+func updateStageTopic(discord *discordgo.Session, guildID string, video VideoInfo) {
+	vc, ok := GlobalQueue.GetVoiceConnection(guildID)
+	if !ok || vc == nil {
+		return
+	}
+	vc.RLock()
+	channelID := vc.ChannelID
+	vc.RUnlock()
+	if channelID == "" || !isStageChannel(discord, channelID) {
+		return
+	}
+
+	topic := "🎶 " + video.Title
+	if utf8.RuneCountInString(topic) > maxStageTopicLength {
+		topic = string([]rune(topic)[:maxStageTopicLength-1]) + "…"
+	}
+
+	if _, err := discord.StageInstance(channelID); err != nil {
+		_, err = discord.StageInstanceCreate(&discordgo.StageInstanceParams{
+			ChannelID:    channelID,
+			Topic:        topic,
+			PrivacyLevel: discordgo.StageInstancePrivacyLevelGuildOnly,
+		})
+		if err != nil {
+			logWarnf("Failed to start stage %s in guild %s: %v", channelID, guildID, err)
+		}
+		return
+	}
+	if _, err := discord.StageInstanceEdit(channelID, &discordgo.StageInstanceParams{Topic: topic}); err != nil {
+		logWarnf("Failed to update stage topic in guild %s: %v", guildID, err)
+	}
+}
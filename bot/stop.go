@@ -1,10 +1,6 @@
 package bot
 
-import (
-	"log"
-
-	"github.com/bwmarrin/discordgo"
-)
+import "github.com/bwmarrin/discordgo"
 
 func HandleStopCommand(discord *discordgo.Session, i *discordgo.InteractionCreate) {
 	guildID := i.GuildID
@@ -47,29 +43,31 @@ func HandleStopCommand(discord *discordgo.Session, i *discordgo.InteractionCreat
 	if found {
 		select {
 		case stopChan <- true:
-			log.Printf("Stop signal sent for guild %s", guildID)
+			logDebugf("Stop signal sent for guild %s", guildID)
 		default:
-			log.Printf("Stop channel full or not listening for guild %s", guildID)
+			logDebugf("Stop channel full or not listening for guild %s", guildID)
 		}
 	} else {
-		log.Printf("No active stop channel for guild %s", guildID)
+		logDebugf("No active stop channel for guild %s", guildID)
 	}
 
 	GlobalQueue.Clear(channelID)
+	GlobalQueue.SetInVoiceChannel(guildID, false)
 
 	vc, ok := GlobalQueue.GetVoiceConnection(guildID)
 	if ok && vc != nil {
 		if err := vc.Disconnect(); err != nil {
-			log.Printf("Failed to disconnect voice connection for guild %s: %v", guildID, err)
+			logWarnf("Failed to disconnect voice connection for guild %s: %v", guildID, err)
 		} else {
-			log.Printf("Disconnected voice connection for guild %s", guildID)
+			logDebugf("Disconnected voice connection for guild %s", guildID)
 		}
 	}
 
-	// CancelIdleMonitor(guildID)
+	cancelIdleTimer(guildID)
+
+	DisableNowPlayingPanel(discord, guildID)
 
 	GlobalQueue.SetPlaying(guildID, false)
-	GlobalQueue.SetInVoiceChannel(guildID, false)
 
 	embed := &discordgo.MessageEmbed{
 		Title:       "⏹️ Playback Stopped",
@@ -1,19 +1,18 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"time"
 
-	"github.com/bwmarrin/dgvoice"
 	"github.com/bwmarrin/discordgo"
 )
 
 func findUserVoiceChannel(discord *discordgo.Session, guildID, userID string) string {
 	guild, err := discord.State.Guild(guildID)
 	if err != nil {
-		log.Printf("Failed to fetch guild state: %v", err)
+		logWarnf("Failed to fetch guild state: %v", err)
 		return ""
 	}
 
@@ -23,11 +22,12 @@ func findUserVoiceChannel(discord *discordgo.Session, guildID, userID string) st
 		}
 	}
 
-	log.Printf("User %s is not in a voice channel", userID)
+	logDebugf("User %s is not in a voice channel", userID)
 	return ""
 }
 
 func JoinVoiceChannel(discord *discordgo.Session, guildID, channelID string) error {
+	GlobalQueue.setVoiceChannel(guildID, channelID)
 	vc, err := discord.ChannelVoiceJoin(guildID, channelID, false, true)
 	if err != nil {
 		return fmt.Errorf("failed to join voice channel: %w", err)
@@ -35,30 +35,65 @@ func JoinVoiceChannel(discord *discordgo.Session, guildID, channelID string) err
 
 	GlobalQueue.SaveVoiceConnection(guildID, vc)
 	GlobalQueue.SetInVoiceChannel(guildID, true)
+	if isStageChannel(discord, channelID) {
+		becomeStageSpeaker(discord, guildID, channelID)
+	}
+	UpdateIdleState(discord, guildID)
 
 	return nil
 }
 
+// Same cleanup as /stop: the queue is cleared, playback stopped and the voice connection closed
+func LeaveVoiceChannel(discord *discordgo.Session, guildID string) {
+	cancelIdleTimer(guildID)
+	if textChannelID := GlobalQueue.GetTextChannel(guildID); textChannelID != "" {
+		GlobalQueue.Clear(textChannelID)
+	}
+	skipCurrentTrack(guildID)
+	// Marked first so the voice state update from disconnecting isn't mistaken for being kicked
+	GlobalQueue.SetInVoiceChannel(guildID, false)
+
+	if vc, ok := GlobalQueue.GetVoiceConnection(guildID); ok && vc != nil {
+		if err := vc.Disconnect(); err != nil {
+			logWarnf("Failed to disconnect voice connection for guild %s: %v", guildID, err)
+		}
+	}
+
+	DisableNowPlayingPanel(discord, guildID)
+	GlobalQueue.SetPlaying(guildID, false)
+	GlobalQueue.SetPaused(guildID, false)
+}
+
 func StartPlaybackIfNotActive(discord *discordgo.Session, guildID, textChannelID string) {
 	if GlobalQueue.IsPlaying(guildID) {
-		log.Printf("Already playing in guild %s, skipping duplicate call", guildID)
+		logDebugf("Already playing in guild %s, skipping duplicate call", guildID)
 		return
 	}
+	// Playback carries on by itself once the reconnect succeeds
+	if GlobalQueue.IsReconnecting(guildID) {
+		logDebugf("Reconnecting to voice in guild %s, not starting playback yet", guildID)
+		return
+	}
+
+	// A session restored after a restart picks up its track where it left off
+	resume, resuming := GlobalQueue.TakeResumePoint(guildID)
 
 	var next VideoInfo
 	var ok bool
 
-	if GlobalQueue.IsShuffleEnabled(textChannelID) {
+	if resuming {
+		next = resume.Video
+	} else if GlobalQueue.IsShuffleEnabled(textChannelID) {
 		next, ok = GlobalQueue.PopRandom(textChannelID)
 		if !ok {
-			log.Printf("Queue for channel %s is empty, nothing to play", textChannelID)
+			logDebugf("Queue for channel %s is empty, nothing to play", textChannelID)
 			GlobalQueue.SetInVoiceChannel(guildID, false)
 			return
 		}
 	} else {
 		next, ok = GlobalQueue.Peek(textChannelID)
 		if !ok {
-			log.Printf("Queue for channel %s is empty, nothing to play", textChannelID)
+			logDebugf("Queue for channel %s is empty, nothing to play", textChannelID)
 			GlobalQueue.SetInVoiceChannel(guildID, false)
 			return
 		}
@@ -74,25 +109,33 @@ func StartPlaybackIfNotActive(discord *discordgo.Session, guildID, textChannelID
 	}
 
 	var current VideoInfo
-	if GlobalQueue.IsShuffleEnabled(textChannelID) {
+	var start time.Duration
+	if resuming {
+		current = next
+		start = resume.Position
+	} else if GlobalQueue.IsShuffleEnabled(textChannelID) {
 		current = next
 	} else {
 		current, ok = GlobalQueue.Pop(textChannelID)
 		if !ok {
-			log.Printf("Queue for channel %s is empty, nothing to play", textChannelID)
+			logDebugf("Queue for channel %s is empty, nothing to play", textChannelID)
 			GlobalQueue.SetInVoiceChannel(guildID, false)
 			return
 		}
 	}
 
 	GlobalQueue.SetCurrentlyPlaying(guildID, current)
+	GlobalQueue.RecordPlayed(guildID, current)
 	GlobalQueue.SetPlaying(guildID, true)
 
-	SendNowPlayingEmbed(discord, textChannelID, current)
+	GlobalQueue.SetPaused(guildID, false)
+	UpdateIdleState(discord, guildID)
+	SendNowPlayingEmbed(discord, guildID, textChannelID, current)
+	go updateStageTopic(discord, guildID, current)
 
 	currentPath, found := GlobalQueue.GetDownloadedFile(current.Title)
 	if !found {
-		log.Printf("File for '%s' not found — skipping and removing from queue", current.Title)
+		logWarnf("File for '%s' not found — skipping and removing from queue", current.Title)
 		GlobalQueue.RemoveByTitle(textChannelID, current.Title)
 		ErrorChan <- GuildError{
 			GuildID: guildID,
@@ -102,7 +145,7 @@ func StartPlaybackIfNotActive(discord *discordgo.Session, guildID, textChannelID
 		return
 	}
 
-	log.Printf("Starting playback of file %s in guild %s", currentPath, guildID)
+	logInfof("Starting playback of file %s in guild %s", currentPath, guildID)
 	GlobalQueue.SetLastActivity(guildID)
 
 	done := make(chan struct{})
@@ -119,12 +162,33 @@ func StartPlaybackIfNotActive(discord *discordgo.Session, guildID, textChannelID
 		}
 	}()
 
-	stop := make(chan bool)
+	// Buffered so a skip or stop isn't lost while the player is between frames
+	stop := make(chan bool, 1)
 	GlobalQueue.Lock()
 	GlobalQueue.stopChans[guildID] = stop
 	GlobalQueue.Unlock()
 
-	dgvoice.PlayAudioFile(vc, currentPath, stop)
+	for {
+		stopped, err := PlayAudioFile(vc, guildID, currentPath, start, stop)
+		start = 0
+		if errors.Is(err, errVoiceLost) {
+			logWarnf("Voice connection lost while playing %s in guild %s", current.Title, guildID)
+			GlobalQueue.beginReconnect(guildID)
+			break
+		}
+		if err != nil {
+			logErrorf("Playback of %s failed in guild %s: %v", currentPath, guildID, err)
+			ErrorChan <- GuildError{
+				GuildID: guildID,
+				Err:     fmt.Errorf("playback of '%s' stopped unexpectedly: %v", current.Title, err),
+			}
+			break
+		}
+		if stopped || !GlobalQueue.IsLoopEnabled(guildID) {
+			break
+		}
+		logDebugf("Looping %s in guild %s", current.Title, guildID)
+	}
 
 	GlobalQueue.Lock()
 	delete(GlobalQueue.stopChans, guildID)
@@ -132,21 +196,103 @@ func StartPlaybackIfNotActive(discord *discordgo.Session, guildID, textChannelID
 	close(stop)
 	close(done)
 
-	log.Printf("Finished playing file %s in guild %s", currentPath, guildID)
+	// The track picks up from the same spot once the bot is back in voice
+	reconnecting := GlobalQueue.IsReconnecting(guildID)
+	if reconnecting || GlobalQueue.takeSuspended(guildID) {
+		GlobalQueue.SetResumePoint(guildID, resumePoint{Video: current, Position: GlobalQueue.GetPosition(guildID)})
+		GlobalQueue.SetPlaying(guildID, false)
+		GlobalQueue.SetPaused(guildID, false)
+		GlobalQueue.SetCurrentlyPlaying(guildID, VideoInfo{})
+		if reconnecting {
+			go reconnectVoice(discord, guildID)
+		}
+		return
+	}
+
+	logDebugf("Finished playing file %s in guild %s", currentPath, guildID)
 
 	GlobalQueue.SetPlaying(guildID, false)
+	GlobalQueue.SetPaused(guildID, false)
+	GlobalQueue.SetPosition(guildID, 0)
 	GlobalQueue.SetCurrentlyPlaying(guildID, VideoInfo{})
 
-	if err := os.Remove(currentPath); err != nil {
-		log.Printf("Failed to delete file %s: %v", currentPath, err)
+	// A duplicate queued anyway shares the same download
+	if GlobalQueue.IsTitleQueued(textChannelID, current.Title) {
+		logDebugf("Keeping file %s, it's queued again", currentPath)
+	} else if err := os.Remove(currentPath); err != nil {
+		logWarnf("Failed to delete file %s: %v", currentPath, err)
 	}
 
 	next, ok = GlobalQueue.Peek(textChannelID)
 	if !ok {
-		log.Printf("No next track in queue for channel %s", textChannelID)
+		logDebugf("No next track in queue for channel %s", textChannelID)
+		DisableNowPlayingPanel(discord, guildID)
+		UpdateIdleState(discord, guildID)
+		continueAlwaysOn(discord, guildID)
 		return
 	}
 
-	log.Printf("Queuing next track: %s", next.Title)
+	logDebugf("Queuing next track: %s", next.Title)
 	StartPlaybackIfNotActive(discord, guildID, textChannelID)
 }
+
+// Non-bot users currently in the given voice channel
+func voiceChannelListeners(discord *discordgo.Session, guildID, channelID string) []string {
+	guild, err := discord.State.Guild(guildID)
+	if err != nil {
+		logWarnf("Failed to fetch guild state: %v", err)
+		return nil
+	}
+
+	var listeners []string
+	for _, vs := range guild.VoiceStates {
+		if vs.ChannelID != channelID || vs.UserID == discord.State.User.ID {
+			continue
+		}
+		if vs.Member != nil && vs.Member.User != nil && vs.Member.User.Bot {
+			continue
+		}
+		if member, err := discord.State.Member(guildID, vs.UserID); err == nil && member.User != nil && member.User.Bot {
+			continue
+		}
+		listeners = append(listeners, vs.UserID)
+	}
+	return listeners
+}
+
+// Commands that change what everyone in the voice channel hears
+var voiceControlCommands = map[string]bool{
+	"play":    true,
+	"skip":    true,
+	"stop":    true,
+	"leave":   true,
+	"clear":   true,
+	"remove":  true,
+	"shuffle": true,
+}
+
+// Responds with an ephemeral error and returns false unless the user is listening in the same voice channel as the bot.
+// Admins are exempt, and servers can turn the check off with /settings.
+func requireSameVoiceChannel(discord *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	guildID := i.GuildID
+	if isAdmin(i) || !GlobalSettings.Get(guildID).RequireSameVoiceChannel {
+		return true
+	}
+
+	userChannelID := findUserVoiceChannel(discord, guildID, GetUserID(i))
+
+	vc, ok := GlobalQueue.GetVoiceConnection(guildID)
+	if !GlobalQueue.IsInVoiceChannel(guildID) || !ok || vc == nil {
+		if userChannelID == "" {
+			respondEphemeral(discord, i, "🔇 You need to join a voice channel first.")
+			return false
+		}
+		return true
+	}
+
+	if userChannelID != vc.ChannelID {
+		respondEphemeral(discord, i, fmt.Sprintf("🔇 You need to be in <#%s> with me to do that.", vc.ChannelID))
+		return false
+	}
+	return true
+}
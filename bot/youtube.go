@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/url"
 	"os/exec"
 	"path/filepath"
@@ -19,6 +18,7 @@ type VideoInfo struct {
 	ID          string  `json:"id"`
 	Title       string  `json:"title"`
 	Uploader    string  `json:"uploader"`
+	Channel     string  `json:"channel"`
 	WebURL      string  `json:"webpage_url"`
 	Duration    float64 `json:"duration"`
 	RequestedBy string
@@ -29,8 +29,22 @@ type SearchResult struct {
 	Videos  []VideoInfo
 }
 
+// Overridden by ApplyConfig
+var (
+	YtDlpPath     = "yt-dlp"
+	downloadSlots = make(chan struct{}, 3)
+)
+
 var youtubeRegex = regexp.MustCompile(`^(https?://)?(www\.)?(youtube\.com|youtu\.be)/.+$`)
 
+// Flat search results often only fill in the channel name
+func (v VideoInfo) uploaderName() string {
+	if v.Uploader != "" {
+		return v.Uploader
+	}
+	return v.Channel
+}
+
 func isYouTubeLink(input string) bool {
 	return youtubeRegex.MatchString(input)
 }
@@ -53,38 +67,41 @@ func sanitizeFilename(name string) string {
 	return re.ReplaceAllString(name, "_")
 }
 
-func YoutubeSearch(query string) SearchResult {
+func YoutubeSearch(query string, count int) (SearchResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
+	return YoutubeSearchContext(ctx, query, count)
+}
 
+func YoutubeSearchContext(ctx context.Context, query string, count int) (SearchResult, error) {
 	args := []string{
 		"--dump-json",
 		"--no-download",
 		"--flat-playlist",
-		"--default-search", "ytsearch15",
+		"--default-search", fmt.Sprintf("ytsearch%d", count),
 		query,
 	}
 
-	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	cmd := exec.CommandContext(ctx, YtDlpPath, args...)
 	cmd.Env = append(cmd.Env, "PYTHONIOENCODING=utf-8")
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
-		log.Fatalf("failed to get stdout pipe: %v", err)
+		return SearchResult{}, fmt.Errorf("failed to get stdout pipe: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
-		log.Fatalf("failed to start yt-dlp: %v", err)
+		return SearchResult{}, fmt.Errorf("failed to start yt-dlp: %w", err)
 	}
 
 	scanner := bufio.NewScanner(stdoutPipe)
 	rawVideos, err := parseYTDLPJSONLines(scanner)
 	if err != nil {
-		log.Fatalf("error reading yt-dlp output: %v", err)
+		return SearchResult{}, fmt.Errorf("error reading yt-dlp output: %w", err)
 	}
 
 	if err := cmd.Wait(); err != nil {
-		log.Fatalf("yt-dlp command failed: %v", err)
+		return SearchResult{}, fmt.Errorf("yt-dlp command failed: %w", err)
 	}
 
 	var videos []VideoInfo
@@ -97,9 +114,6 @@ func YoutubeSearch(query string) SearchResult {
 			continue
 		}
 		videos = append(videos, video)
-		if len(videos) >= 5 {
-			break // discord only allows 5 components (in this case buttons) in a message
-		}
 	}
 
 	var builder strings.Builder
@@ -108,7 +122,7 @@ func YoutubeSearch(query string) SearchResult {
 		seconds := int(video.Duration) % 60
 		fmt.Fprintf(&builder, "Result #%d:\n", i+1)
 		fmt.Fprintf(&builder, "Title: %s\n", video.Title)
-		fmt.Fprintf(&builder, "Channel: %s\n", video.Uploader)
+		fmt.Fprintf(&builder, "Channel: %s\n", video.uploaderName())
 		fmt.Fprintf(&builder, "URL: %s\n", video.WebURL)
 		fmt.Fprintf(&builder, "Duration: %02d:%02d\n\n", minutes, seconds)
 	}
@@ -116,17 +130,21 @@ func YoutubeSearch(query string) SearchResult {
 	return SearchResult{
 		Message: builder.String(),
 		Videos:  videos,
-	}
+	}, nil
 }
 
 func YoutubeDownloadAudio(url string, title string) (string, error) {
+	// Too many yt-dlp processes at once get the bot rate limited
+	downloadSlots <- struct{}{}
+	defer func() { <-downloadSlots }()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
 	defer cancel()
 
 	safeTitle := sanitizeFilename(title)
 	AudioPath := filepath.Join(CacheDir, safeTitle+".mp3")
 
-	cmd := exec.CommandContext(ctx, "yt-dlp", "-f", "bestaudio", "-x", "--audio-format", "mp3", "-o", AudioPath, url)
+	cmd := exec.CommandContext(ctx, YtDlpPath, "-f", "bestaudio", "-x", "--audio-format", "mp3", "-o", AudioPath, url)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return "", fmt.Errorf("yt-dlp download failed: %w, output: %s", err, string(output))
 	}
@@ -137,8 +155,11 @@ func YoutubeDownloadAudio(url string, title string) (string, error) {
 func YoutubeGetInfo(url string) (VideoInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
+	return YoutubeGetInfoContext(ctx, url)
+}
 
-	cmd := exec.CommandContext(ctx, "yt-dlp", "--dump-json", "--no-playlist", url)
+func YoutubeGetInfoContext(ctx context.Context, url string) (VideoInfo, error) {
+	cmd := exec.CommandContext(ctx, YtDlpPath, "--dump-json", "--no-playlist", url)
 	cmd.Env = append(cmd.Env, "PYTHONIOENCODING=utf-8")
 
 	stdoutPipe, err := cmd.StdoutPipe()
@@ -177,7 +198,7 @@ func YoutubeGetInfo(url string) (VideoInfo, error) {
 		return VideoInfo{}, fmt.Errorf("no video info returned for URL")
 	}
 
-	log.Printf("yt-dlp parsed video info: %+v", videos[0])
+	logDebugf("yt-dlp parsed video info: %+v", videos[0])
 
 	return videos[0], nil
 }
@@ -188,7 +209,7 @@ func parseYTDLPJSONLines(scanner *bufio.Scanner) ([]VideoInfo, error) {
 		line := scanner.Text()
 		var info VideoInfo
 		if err := json.Unmarshal([]byte(line), &info); err != nil {
-			log.Printf("Skipping invalid JSON line: %v", err)
+			logDebugf("Skipping invalid JSON line: %v", err)
 			continue
 		}
 		videos = append(videos, info)
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
 
@@ -9,10 +13,46 @@ import (
 )
 
 func main() {
-	err := godotenv.Load()
+	configPath := flag.String("config", "", "path to a YAML config file (defaults to config.yaml if it exists)")
+	checkConfig := flag.Bool("check-config", false, "validate the configuration and exit")
+	cacheDir := flag.String("cache-dir", "", "directory for downloaded audio, overrides the config file")
+	databasePath := flag.String("database", "", "path to the settings database, overrides the config file")
+	logLevel := flag.String("log-level", "", "debug, info, warn or error, overrides the config file")
+	dryRunCommands := flag.Bool("dry-run-commands", false, "log slash command changes without applying them")
+	flag.Parse()
+
+	// .env is optional, variables can just as well come from the real environment
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to load .env file: %v", err)
+	}
+
+	cfg, err := bot.LoadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if *cacheDir != "" {
+		cfg.CacheDir = *cacheDir
+	}
+	if *databasePath != "" {
+		cfg.DatabasePath = *databasePath
+	}
+	if *logLevel != "" {
+		cfg.LogLevel = *logLevel
 	}
-	bot.BotToken = os.Getenv("DISCORD_BOT_TOKEN")
+	if *dryRunCommands {
+		cfg.CommandSyncDryRun = true
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if *checkConfig {
+		fmt.Print(cfg.Summary())
+		fmt.Println("Configuration OK")
+		return
+	}
+
+	bot.ApplyConfig(cfg)
 	bot.Run()
 }